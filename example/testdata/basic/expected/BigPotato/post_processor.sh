@@ -0,0 +1,5 @@
+#!/bin/bash
+
+echo "Post-processing steps go here"
+echo "This script may also contain templated values itself."
+echo "Example value: {{ .foo }}"
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
+)
+
+// test runs "sprout test", which renders each of a template's golden test
+// cases and compares the output with the case's expected output, then exits.
+// It exits with status 1 if any case fails.
+func test(args []string) {
+	flags := flag.NewFlagSet("sprout test", flag.ExitOnError)
+
+	var sourceConfigPath string
+	flags.StringVar(&sourceConfigPath, "source-config", "", "The definition config of the template to test.")
+
+	var cacheDir string
+	flags.StringVar(&cacheDir, "cache-dir", sprout.DefaultCacheDir(), "The directory where templates fetched from git repositories are cached.")
+
+	var update bool
+	flags.BoolVar(&update, "update", false, "Rewrite the expected output of each test case whose output differs, rather than failing it.")
+
+	var jobs int
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), "How many template files to render in parallel.")
+
+	flags.Parse(args)
+
+	hasErrors := false
+	if sourceConfigPath == "" {
+		fmt.Println("--source-config is required and not defined")
+		hasErrors = true
+	}
+	if jobs < 1 {
+		fmt.Println("--jobs must be at least 1")
+		hasErrors = true
+	}
+	if hasErrors {
+		os.Exit(1)
+	}
+
+	template, err := sprout.OpenTemplate(sourceConfigPath, cacheDir)
+	if err != nil {
+		processor.Printfln("%s", err.Error())
+		os.Exit(1)
+	}
+
+	result, err := template.Test(update, jobs, processor.Printfln)
+	os.Stdout.Write(result.Diff)
+	if err != nil {
+		processor.Printfln("%s", err.Error())
+		os.Exit(1)
+	}
+	if len(result.Failed) > 0 {
+		processor.Printfln("%d of %d test cases failed", len(result.Failed), len(result.Failed)+len(result.Passed)+len(result.Updated))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
+)
+
+// lint runs "sprout lint", which checks every file of a template without
+// rendering any output, then exits. It exits with status 1 if there are any
+// findings.
+func lint(args []string) {
+	flags := flag.NewFlagSet("sprout lint", flag.ExitOnError)
+
+	var sourceConfigPath string
+	flags.StringVar(&sourceConfigPath, "source-config", "", "The definition config of the template to lint.")
+
+	var cacheDir string
+	flags.StringVar(&cacheDir, "cache-dir", sprout.DefaultCacheDir(), "The directory where templates fetched from git repositories are cached.")
+
+	flags.Parse(args)
+
+	if sourceConfigPath == "" {
+		fmt.Println("--source-config is required and not defined")
+		os.Exit(1)
+	}
+
+	template, err := sprout.OpenTemplate(sourceConfigPath, cacheDir)
+	if err != nil {
+		processor.Printfln("%s", err.Error())
+		os.Exit(1)
+	}
+
+	findings := template.Lint()
+	for _, finding := range findings {
+		fmt.Println(finding.String())
+	}
+	if len(findings) > 0 {
+		processor.Printfln("found %d problems in %s", len(findings), sourceConfigPath)
+		os.Exit(1)
+	}
+	processor.Printfln("no problems found in %s", sourceConfigPath)
+}
@@ -1,22 +1,50 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"syscall"
 
 	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
 )
 
 func main() {
-	const defaultDigestFile = "digest.txt"
+	// An isolated post-processor or hook re-executes sprout, which runs it
+	// here instead.
+	processor.MaybeRunSandboxed()
+
+	// "sprout lint" and "sprout test" check a template, rather than
+	// sprouting it.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			lint(os.Args[2:])
+			return
+		case "test":
+			test(os.Args[2:])
+			return
+		}
+	}
 
 	var sourceConfigPath string
 	flag.StringVar(&sourceConfigPath, "source-config", "", "The definition config of the template to sprout.")
 
+	var cacheDir string
+	flag.StringVar(&cacheDir, "cache-dir", sprout.DefaultCacheDir(), "The directory where templates fetched from git repositories are cached.")
+
 	var outputRoot string
 	flag.StringVar(&outputRoot, "output", "", "The root directory where sprouted output should be placed. This directory will be created if it does not exist.")
 
@@ -27,61 +55,122 @@ func main() {
 	flag.BoolVar(&unused, "delete-existing-output", false, "This flag is unused.")
 
 	var digestPath string
-	flag.StringVar(&digestPath, "digest", defaultDigestFile, "record the filepaths of each generated file, so they can be cleaned up if necessary.")
+	flag.StringVar(&digestPath, "digest", sprout.DefaultDigestPath, "record the filepaths and hashes of each generated file, so they can be cleaned up if necessary.")
+
+	var modifiedPolicyName string
+	flag.StringVar(&modifiedPolicyName, "modified-files", string(processor.ModifiedSkip), "What to do with files from the previous run which have been modified since sprout wrote them: \"skip\" leaves them in place, \"backup\" moves them to a timestamped directory next to the digest, and \"overwrite\" replaces them.")
+
+	var force bool
+	flag.BoolVar(&force, "force", false, "Overwrite files from the previous run even if they've been modified since sprout wrote them. Equivalent to --modified-files=overwrite.")
+
+	var interactive bool
+	flag.BoolVar(&interactive, "interactive", false, "Prompt for each param on the terminal, write the answers to the params file, then sprout the template. Values already in the params file, or else the example values from the template's params file, are offered as defaults.")
+
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "Print a diff of the changes that sprouting would make to the output directory, without changing anything on disk.")
+
+	var update bool
+	flag.BoolVar(&update, "update", false, "Preserve edits made to previously sprouted files. Each file is merged three ways, between the previous output, the user's current file and the new output. Overlapping changes are marked with conflict markers, to be resolved by hand.")
 
 	var autoRunPostProcessor bool
-	flag.BoolVar(&autoRunPostProcessor, "autorun-postprocessor", false, "Automatically execute a post-processing script, if it's specified by the template config. Note that this script can execute arbitrary commands on the host computer. It's best to examine such scripts then execute them manually, unless the template comes from a trusted source.")
+	flag.BoolVar(&autoRunPostProcessor, "autorun-postprocessor", false, "Automatically execute a post-processing script and hooks, if they're specified by the template config. Note that these can execute arbitrary commands on the host computer. It's best to examine such scripts then execute them manually, unless the template comes from a trusted source.")
+
+	var commandPolicyName string
+	flag.StringVar(&commandPolicyName, "postprocessor-policy", string(sprout.CommandsManual), "Whether to run the template's post-processing script and hooks: \"manual\" prints them, to be examined and run by hand, \"auto\" runs them, like --autorun-postprocessor, and \"allowlist\" asks for approval of the commands the template declares, then runs them in a sandbox whose PATH only contains those commands. Approvals are remembered until the script or hooks change.")
+
+	var approvalsPath string
+	flag.StringVar(&approvalsPath, "approvals", sprout.DefaultApprovalsPath(), "The file where approvals for --postprocessor-policy=allowlist are remembered.")
+
+	var jobs int
+	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), "How many template files to render in parallel.")
+
+	var outputFormat string
+	flag.StringVar(&outputFormat, "output-format", "text", "How to report the result: \"text\" prints progress and errors as they happen, and \"json\" prints a single report of the run to stdout when it finishes, with progress on stderr. The exit code says which kind of error stopped the run, either way.")
 
 	flag.Parse()
 
-	templateMgrFactories := map[string]func() processor.TemplateMgr{
-		".gotmpl": processor.GoTemplateMgr,
-		".jet":    processor.JetTemplateMgr,
-		".pongo":  processor.PongoTemplateMgr,
+	// In JSON mode, stdout is reserved for the report.
+	logf := processor.Printfln
+	promptOutput := io.Writer(os.Stdout)
+	if outputFormat == "json" {
+		logf = func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		}
+		promptOutput = os.Stderr
 	}
 
-	hasErrors := false
-	if sourceConfigPath == "" {
-		fmt.Println("--source-config is required and not defined")
-		hasErrors = true
+	// finish reports the result of the run, then exits with the code for the
+	// category of err.
+	finish := func(result sprout.Result, err error) {
+		if outputFormat == "json" {
+			reportBytes, marshalErr := json.MarshalIndent(sprout.NewReport(result, err), "", "  ")
+			if marshalErr != nil {
+				fmt.Fprintf(os.Stderr, "error encoding report: %s\n", marshalErr.Error())
+				os.Exit(exitOther)
+			}
+			os.Stdout.Write(append(reportBytes, '\n'))
+		} else {
+			os.Stdout.Write(result.Diff)
+			for _, err := range sprout.Errors(err) {
+				fmt.Println(err.Error())
+			}
+		}
+		os.Exit(exitCode(err))
+	}
+	fail := func(category sprout.ErrorCategory, s string, args ...any) {
+		finish(sprout.Result{}, &sprout.Error{Category: category, Err: fmt.Errorf(s, args...)})
 	}
-	inputRoot := filepath.Dir(sourceConfigPath)
-	configFile := filepath.Base(sourceConfigPath)
 
+	var usageErrs []error
+	addUsageError := func(s string, args ...any) {
+		usageErrs = append(usageErrs, &sprout.Error{Category: usageError, Err: fmt.Errorf(s, args...)})
+	}
+	if outputFormat != "text" && outputFormat != "json" {
+		// Report this one as text, since the format is in doubt.
+		outputFormat = "text"
+		addUsageError("--output-format must be \"text\" or \"json\"")
+	}
+	if sourceConfigPath == "" {
+		addUsageError("--source-config is required and not defined")
+	}
 	if outputRoot == "" {
-		fmt.Println("--output is required and not defined")
-		hasErrors = true
+		addUsageError("--output is required and not defined")
+	}
+
+	modifiedPolicy, err := processor.ParseModifiedPolicy(modifiedPolicyName)
+	if err != nil {
+		addUsageError("error in --modified-files: %s", err.Error())
+	}
+	if force {
+		modifiedPolicy = processor.ModifiedOverwrite
 	}
-	outputRoot = filepath.Clean(outputRoot) + "/"
 
-	// Load the digest file, if it exists.
-	absDigestPath := filepath.Join(outputRoot, digestPath)
-	if digestPath == defaultDigestFile {
-		processor.Printfln("using default digest path %s", absDigestPath)
+	commandPolicy, err := sprout.ParseCommandPolicy(commandPolicyName)
+	if err != nil {
+		addUsageError("error in --postprocessor-policy: %s", err.Error())
 	}
-	digestBytes, err := os.ReadFile(absDigestPath)
-	if err != nil && !os.IsNotExist(err) {
-		processor.Printfln("error reading digest file: %s", err.Error())
-		hasErrors = true
+	if autoRunPostProcessor && commandPolicy == sprout.CommandsAllowlist {
+		addUsageError("--autorun-postprocessor can't be combined with --postprocessor-policy=allowlist")
+	}
+	if autoRunPostProcessor {
+		commandPolicy = sprout.CommandsAuto
 	}
 
-	var digestPaths []string
-	if err == nil {
-		digestPaths = strings.Split(string(digestBytes), "\n")
-		digestPaths = append(digestPaths, digestPath)
+	if jobs < 1 {
+		addUsageError("--jobs must be at least 1")
+	}
+
+	if len(usageErrs) > 0 {
+		finish(sprout.Result{}, errors.Join(usageErrs...))
 	}
 
 	// Load the template config.
-	var config processor.Config
-	configLoader := processor.MakeFileLoader(inputRoot, ".", os.ReadFile)
-	err = configLoader.LoadFile(configFile, &config)
+	template, err := sprout.OpenTemplate(sourceConfigPath, cacheDir)
 	if err != nil {
-		processor.Printfln("error loading source config: %s", err.Error())
-		hasErrors = true
+		fail(sprout.ConfigError, "%s", err.Error())
 	}
-
-	if hasErrors {
-		os.Exit(1)
+	if template.Source.Commit != "" {
+		logf("using commit %s of %s", template.Source.Commit, sourceConfigPath)
 	}
 
 	// Load the params template file. This is an example or placeholder file
@@ -92,100 +181,154 @@ func main() {
 	//
 	// The next time we run sprout, the final params file will already exist,
 	// and we'll skip this step and just run the actual template execution.
-	paramsLoader := processor.MakeFileLoader(".", ".", os.ReadFile)
+	paramsLoader := processor.MakeFileLoader(os.DirFS(filepath.Dir(paramsPath)), ".", ".")
+	paramsFile := filepath.Base(paramsPath)
 
 	var params processor.Params
-	err = paramsLoader.LoadFile(paramsPath, &params)
-	if os.IsNotExist(err) {
-		templateParamsPath := filepath.Join(inputRoot, config.TemplateParamsFile)
-		err := processor.Copy(templateParamsPath, paramsPath)
+	err = paramsLoader.LoadFile(paramsFile, &params)
+	if interactive {
+		// In interactive mode, ask the user for each param instead. The
+		// current params are offered as defaults if they exist, otherwise the
+		// example values from the params template are offered.
+		defaults := params
+		if os.IsNotExist(err) {
+			defaults, err = template.LoadExampleParams()
+			if err != nil {
+				fail(sprout.ConfigError, "%s", err.Error())
+			}
+		} else if err != nil {
+			fail(sprout.ParamsError, "error loading params from %s: %s", paramsPath, err.Error())
+		}
+
+		params, err = processor.PromptParams(os.Stdin, promptOutput, defaults, template.ParamsSchema())
+		if err != nil {
+			fail(sprout.ParamsError, "error prompting for params: %s", err.Error())
+		}
+
+		// A dry run changes nothing on disk, so the answers are only used for
+		// this run.
+		paramsBytes, err := paramsLoader.SerializeBytes(paramsFile, params)
+		if err == nil && !dryRun {
+			err = os.WriteFile(paramsPath, paramsBytes, 0644)
+		}
 		if err != nil {
-			processor.Printfln("error copying params template from %s to %s: %s", config.TemplateParamsFile, paramsPath, err.Error())
-			hasErrors = true
+			fail(sprout.ParamsError, "error writing params to %s: %s", paramsPath, err.Error())
+		}
+		if dryRun {
+			logf("dry run: would write params to %s:\n%s", paramsPath, paramsBytes)
 		} else {
-			processor.Printfln("created placeholder params at %s. customize the file, then rerun your previous command.", paramsPath)
-			os.Exit(0)
+			logf("wrote params to %s", paramsPath)
+		}
+	} else if os.IsNotExist(err) {
+		templateParamsBytes, err := template.ExampleParams()
+		if err == nil && !dryRun {
+			err = os.WriteFile(paramsPath, templateParamsBytes, 0644)
+		}
+		if err != nil {
+			fail(sprout.ParamsError, "error copying params template to %s: %s", paramsPath, err.Error())
+		}
+		message := fmt.Sprintf("created placeholder params at %s. customize the file, then rerun your previous command.", paramsPath)
+		if dryRun {
+			message = fmt.Sprintf("dry run: would create placeholder params at %s, from the template's example params. rerun without --dry-run to create them.", paramsPath)
 		}
+		logf("%s", message)
+		finish(sprout.Result{Template: template, Warnings: []string{message}}, nil)
+	} else if err != nil {
+		fail(sprout.ParamsError, "error loading params from %s: %s", paramsPath, err.Error())
 	}
 
-	// Select a template engine, based on the TemplateTypeExt specified in the config.
-	templateMgrFactory, hasExt := templateMgrFactories[config.TemplateTypeExt]
-	if !hasExt {
-		processor.Printfln("unrecognized template type %q in config", config.TemplateTypeExt)
-		hasErrors = true
+	generator := sprout.Generator{
+		Source: sourceConfigPath,
+		Params: params,
+		Output: outputRoot,
+		Options: sprout.Options{
+			DigestPath:     digestPath,
+			ModifiedPolicy: modifiedPolicy,
+			Update:         update,
+			DryRun:         dryRun,
+			CommandPolicy:  commandPolicy,
+			ApprovalsPath:  approvalsPath,
+			Approve:        approvalPrompter(promptOutput),
+			Jobs:           jobs,
+			CacheDir:       cacheDir,
+			Log:            logf,
+		},
 	}
-	templateMgr := templateMgrFactory()
+	// An interrupt cancels the run, rolling back any changes to the output
+	// directory, rather than killing sprout part way through them.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	result, err := generator.RunTemplate(ctx, template)
+	stop()
+	finish(result, err)
+}
 
-	// Reload the config again, and this type parse it as a template using
-	// the params as an input. This will fully resolve any templated variables
-	// anywhere in the config specification.
-	configBytes, err := configLoader.LoadFileAsBytes(configFile)
-	if err != nil {
-		processor.Printfln("error reloading config for template rewrite?!?: %s", err.Error())
-		hasErrors = true
-	}
-	err = templateMgr.ParseOne("__config__", configBytes)
-	if err != nil {
-		processor.Printfln("error processing config as template: %s", err.Error())
-		hasErrors = true
-	}
+// The exit codes of sprout. 2 is what the flag package exits with for a flag
+// it can't parse, so it's used for the other usage errors too.
+const (
+	exitOther         = 1
+	exitUsage         = 2
+	exitConfig        = 3
+	exitParams        = 4
+	exitTemplate      = 5
+	exitWrite         = 6
+	exitPostProcessor = 7
+)
 
-	var processedConfigBuf bytes.Buffer
-	err = templateMgr.Execute("__config__", params, &processedConfigBuf)
-	if err != nil {
-		processor.Printfln("error executing config template: %s", err.Error())
-		hasErrors = true
+// usageError is the category of an error in the command line.
+const usageError sprout.ErrorCategory = "usage"
+
+// exitCode returns the exit code for err, from the category of the first of
+// its errors which has one.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	switch sprout.Category(err) {
+	case usageError:
+		return exitUsage
+	case sprout.ConfigError:
+		return exitConfig
+	case sprout.ParamsError:
+		return exitParams
+	case sprout.TemplateError:
+		return exitTemplate
+	case sprout.WriteError:
+		return exitWrite
+	case sprout.PostProcessorError:
+		return exitPostProcessor
 	}
+	return exitOther
+}
 
-	var processedConfig processor.Config
-	err = configLoader.DeserializeBytes(sourceConfigPath, processedConfigBuf.Bytes(), &processedConfig)
-	if err != nil {
-		processor.Printfln("error deserializing processed config bytes: %s", err.Error())
-		hasErrors = true
-	}
-
-	// If we've encountered any errors so far, exit before we start doing any
-	// mutations to the filesystem.
-	if hasErrors {
-		os.Exit(1)
-	}
-
-	// Delete all entries from the digest, which represents files written by a
-	// previous run of sprout. If removing a file would leave its directory
-	// empty, remove the directory also. Recursively repeat this until a
-	// nonempty directory is found.
-	for _, digestEntry := range digestPaths {
-		for digestPart := digestEntry; digestPart != ""; digestPart = filepath.Dir(digestPart) {
-			pathInOutput := filepath.Join(outputRoot, digestPart)
-			err = os.Remove(pathInOutput)
-			if err != nil && digestPart == digestEntry {
-				processor.Printfln("error removing digest entry %s: %s", pathInOutput, err.Error())
-				hasErrors = true
+// approvalPrompter returns an Approve function, which shows the user what the
+// template will run on out, and asks them to approve it.
+func approvalPrompter(out io.Writer) func(sprout.ApprovalRequest) (bool, error) {
+	return func(request sprout.ApprovalRequest) (bool, error) {
+		if request.Previous != nil {
+			fmt.Fprintf(out, "\nThe post-processor or hooks of %s have CHANGED since you approved them.\n", request.Template)
+		} else {
+			fmt.Fprintf(out, "\n%s wants to run a post-processor or hooks.\n", request.Template)
+		}
+		fmt.Fprintf(out, "\nThey'll run in a sandbox, whose PATH only contains these commands: %s\nA script can still run other programs by their absolute paths.\n", strings.Join(request.Approval.Commands, ", "))
+		for _, script := range slices.Sorted(maps.Keys(request.ScriptContents)) {
+			fmt.Fprintf(out, "\nPost-processor %s:\n\n%s\n", script, request.ScriptContents[script])
+		}
+		for _, step := range append(request.Hooks.PreGenerate, request.Hooks.PostGenerate...) {
+			fmt.Fprintf(out, "\nHook: %s\n", strings.Join(append([]string{step.Command}, step.Args...), " "))
+			if step.Dir != "" {
+				fmt.Fprintf(out, "  in directory %s\n", step.Dir)
 			}
-			if err != nil {
-				break
+			for _, key := range slices.Sorted(maps.Keys(step.Env)) {
+				fmt.Fprintf(out, "  with %s=%s\n", key, step.Env[key])
 			}
-			processor.Printfln("delete digest entry %s", pathInOutput)
 		}
-	}
+		fmt.Fprint(out, "\nApprove? [y/N] ")
 
-	// Execute the template logic.
-	errs := processor.Process(
-		templateMgrFactory(),
-		inputRoot,
-		outputRoot,
-		absDigestPath,
-		autoRunPostProcessor,
-		processedConfig,
-		params,
-		os.ReadFile,
-		os.WriteFile,
-	)
-	for _, err := range errs {
-		fmt.Println(err.Error())
-	}
-
-	if len(errs) > 0 {
-		os.Exit(1)
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("error reading approval: %s", err.Error())
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes", nil
 	}
 }
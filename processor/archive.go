@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// The extensions of the archive formats which a template may be read from.
+var archiveExts = []string{".tar.gz", ".tgz", ".zip"}
+
+// IsArchiveSource reports whether a --source-config value refers to a config
+// file inside an archive, written as <archive path>//<path in archive>, e.g.
+// bundles/service-v1.4.0.tar.gz//templates/config.hjson.
+func IsArchiveSource(s string) bool {
+	archivePath, _, hasSep := strings.Cut(s, "//")
+	if !hasSep {
+		return false
+	}
+	return slices.ContainsFunc(archiveExts, func(ext string) bool {
+		return strings.HasSuffix(archivePath, ext)
+	})
+}
+
+// ParseArchiveSource splits an archive source into the path of the archive,
+// and the path of the config file inside it.
+func ParseArchiveSource(s string) (string, string, error) {
+	archivePath, configPath, _ := strings.Cut(s, "//")
+	configPath = path.Clean(configPath)
+	if configPath == "." || !fs.ValidPath(configPath) {
+		return "", "", fmt.Errorf("archive source %q must name a config file inside the archive", s)
+	}
+	return archivePath, configPath, nil
+}
+
+// OpenArchive reads every regular file in the .tar.gz, .tgz or .zip file at
+// archivePath into memory, and returns them as a filesystem. The file modes
+// recorded in the archive are preserved.
+func OpenArchive(archivePath string) (*MemFS, error) {
+	archiveBytes, err := os.ReadFile(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := NewMemFS()
+	if strings.HasSuffix(archivePath, ".zip") {
+		err = readZip(archive, archiveBytes)
+	} else {
+		err = readTarGz(archive, archiveBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive %s: %s", archivePath, err.Error())
+	}
+	return archive, nil
+}
+
+func readTarGz(archive *MemFS, archiveBytes []byte) error {
+	gz, err := gzip.NewReader(bytes.NewReader(archiveBytes))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		contents, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		err = addArchiveFile(archive, header.Name, contents, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readZip(archive *MemFS, archiveBytes []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(archiveBytes), int64(len(archiveBytes)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		contents, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		// Zip files written without Unix modes report 0666.
+		err = addArchiveFile(archive, f.Name, contents, f.Mode().Perm()&^0022)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addArchiveFile(archive *MemFS, name string, contents []byte, mode os.FileMode) error {
+	name = path.Clean(name)
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("archive entry %q is outside the archive root", name)
+	}
+	return archive.WriteFile(name, contents, mode)
+}
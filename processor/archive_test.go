@@ -0,0 +1,120 @@
+package processor_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+var archiveFiles = map[string]string{
+	"bundle/config.hjson":             "{}",
+	"bundle/templates/README.md.tmpl": "hello {{ .name }}",
+	"bundle/templates/run.sh":         "#!/bin/sh",
+	"bundle/templates/.hidden":        "skipped",
+}
+
+func writeTarGz(t *testing.T, path string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, contents := range archiveFiles {
+		mode := int64(0644)
+		if filepath.Ext(name) == ".sh" {
+			mode = 0755
+		}
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+		require.NoError(t, err)
+		_, err = tw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+}
+
+func writeZip(t *testing.T, path string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, contents := range archiveFiles {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		if filepath.Ext(name) == ".sh" {
+			header.SetMode(0755)
+		}
+		w, err := zw.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+}
+
+func TestParseArchiveSource(t *testing.T) {
+	require.True(t, processor.IsArchiveSource("bundles/service.tar.gz//bundle/config.hjson"))
+	require.True(t, processor.IsArchiveSource("bundles/service.tgz//config.hjson"))
+	require.True(t, processor.IsArchiveSource("bundles/service.zip//config.hjson"))
+	require.False(t, processor.IsArchiveSource("bundles/service.zip"))
+	require.False(t, processor.IsArchiveSource("templates/config.hjson"))
+
+	archivePath, configPath, err := processor.ParseArchiveSource("bundles/service.zip//bundle/config.hjson")
+	require.NoError(t, err)
+	require.Equal(t, "bundles/service.zip", archivePath)
+	require.Equal(t, "bundle/config.hjson", configPath)
+
+	_, _, err = processor.ParseArchiveSource("bundles/service.zip//../config.hjson")
+	require.Error(t, err)
+}
+
+func TestRenderFromArchive(t *testing.T) {
+	for _, archiveName := range []string{"bundle.tar.gz", "bundle.zip"} {
+		t.Run(archiveName, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), archiveName)
+			if archiveName == "bundle.zip" {
+				writeZip(t, archivePath)
+			} else {
+				writeTarGz(t, archivePath)
+			}
+
+			archive, err := processor.OpenArchive(archivePath)
+			require.NoError(t, err)
+
+			configBytes, err := fs.ReadFile(archive, "bundle/config.hjson")
+			require.NoError(t, err)
+			require.Equal(t, "{}", string(configBytes))
+
+			_, err = fs.ReadFile(archive, "bundle/missing.txt")
+			require.True(t, os.IsNotExist(err))
+
+			config := processor.Config{
+				TemplateTypeExt: ".tmpl",
+				DirsMapping:     map[string]string{"templates": "."},
+			}
+			outputContents, errs := processor.Render(
+				processor.GoTemplateMgr,
+				"bundle",
+				"/output",
+				config,
+				processor.Params{"name": "world"},
+				1,
+				archive,
+				processor.Printfln,
+			)
+			require.Empty(t, errs)
+			require.Equal(t, map[string]processor.OutputFile{
+				"/output/README.md": {Content: []byte("hello world"), Template: "templates/README.md.tmpl", MappedDir: ".", Mode: 0644},
+				"/output/run.sh":    {Content: []byte("#!/bin/sh"), Template: "templates/run.sh", MappedDir: ".", Mode: 0755},
+			}, outputContents)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// parseConditions converts the values of Config.Conditions to booleans. By
+// the time Render sees the config, each value has already been resolved as a
+// template expression against the params, so it's just the text "true" or
+// "false" (in any capitalization, depending on the template engine). An
+// empty value is false.
+func parseConditions(conditions map[string]string) (map[string]bool, []error) {
+	var errs []error
+	parsed := map[string]bool{}
+	for pattern, value := range conditions {
+		isTrue, err := parseCondition(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("condition for %q %s", pattern, err.Error()))
+			continue
+		}
+		parsed[pattern] = isTrue
+	}
+	return parsed, errs
+}
+
+// parseCondition converts a single resolved condition to a boolean. An empty
+// value is false.
+func parseCondition(value string) (bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false, nil
+	}
+	isTrue, err := strconv.ParseBool(strings.ToLower(value))
+	if err != nil {
+		return false, fmt.Errorf("must resolve to true or false, got %q", value)
+	}
+	return isTrue, nil
+}
+
+// excludedByCondition returns the pattern of a false condition which matches
+// the input file name, or "" if the file should be included.
+func excludedByCondition(conditions map[string]bool, name string) string {
+	for _, pattern := range slices.Sorted(maps.Keys(conditions)) {
+		if !conditions[pattern] && MatchGlob(pattern, name) {
+			return pattern
+		}
+	}
+	return ""
+}
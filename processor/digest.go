@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+)
+
+// Digest records what a run of sprout wrote to the output directory, so that
+// a later run can clean it up, and can tell which files the user has since
+// modified.
+type Digest struct {
+	SproutVersion  string
+	TemplateConfig string
+	TemplateCommit string `json:",omitempty"`
+	ParamsHash     string
+	Files          []DigestFile
+}
+
+// TemplateSource identifies the template used for a run. Config is the
+// --source-config value. Commit is the commit that a git source's ref
+// resolved to, and is empty for templates on the local filesystem.
+type TemplateSource struct {
+	Config string
+	Commit string
+}
+
+// DigestFile records a single file written by sprout. Path is relative to the
+// output root, and Template is relative to the template's input root.
+type DigestFile struct {
+	Path      string
+	SHA256    string
+	Template  string
+	MappedDir string
+	Mode      os.FileMode
+}
+
+// ParseDigest decodes a digest file. Older versions of sprout wrote the digest
+// as a newline-separated list of paths. Those are still accepted, but the
+// resulting entries have no hashes, so modifications can't be detected.
+func ParseDigest(digestBytes []byte) (Digest, error) {
+	var digest Digest
+	if bytes.HasPrefix(bytes.TrimSpace(digestBytes), []byte("{")) {
+		err := json.Unmarshal(digestBytes, &digest)
+		return digest, err
+	}
+
+	for _, path := range strings.Split(string(digestBytes), "\n") {
+		if path == "" {
+			continue
+		}
+		digest.Files = append(digest.Files, DigestFile{Path: path})
+	}
+	return digest, nil
+}
+
+// Marshal encodes the digest for writing to disk.
+func (d Digest) Marshal() ([]byte, error) {
+	digestBytes, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(digestBytes, '\n'), nil
+}
+
+// Paths returns the path of each file in the digest.
+func (d Digest) Paths() []string {
+	paths := make([]string, len(d.Files))
+	for i, file := range d.Files {
+		paths[i] = file.Path
+	}
+	return paths
+}
+
+// IsModified reports whether the file has changed since sprout wrote it. A
+// file which no longer exists, or which has no recorded hash, is not
+// considered modified.
+func (f DigestFile) IsModified(outputRoot string, readFileFn func(string) ([]byte, error)) (bool, error) {
+	if f.SHA256 == "" {
+		return false, nil
+	}
+
+	content, err := readFileFn(filepath.Join(outputRoot, f.Path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return HashBytes(content) != f.SHA256, nil
+}
+
+// HashBytes returns the hex-encoded SHA-256 of b.
+func HashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashParams returns a hash identifying the params. Equal params always have
+// equal hashes, independent of map ordering.
+func HashParams(params Params) (string, error) {
+	// json.Marshal sorts map keys, so the encoding is canonical.
+	paramsBytes, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	return HashBytes(paramsBytes), nil
+}
+
+// SproutVersion returns the module version of the running sprout binary, or
+// "(devel)" if it was built from a local checkout.
+func SproutVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(unknown)"
+	}
+	return info.Main.Version
+}
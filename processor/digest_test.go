@@ -0,0 +1,68 @@
+package processor_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestParseDigest(t *testing.T) {
+	digest := processor.Digest{
+		SproutVersion:  "v1.0.0",
+		TemplateConfig: "example/config.hjson",
+		ParamsHash:     "abc",
+		Files: []processor.DigestFile{
+			{
+				Path:      "BigPotato/index.html",
+				SHA256:    processor.HashBytes([]byte("index")),
+				Template:  "templates/index.html.gotmpl",
+				MappedDir: "BigPotato",
+				Mode:      0644,
+			},
+		},
+	}
+	digestBytes, err := digest.Marshal()
+	require.NoError(t, err)
+
+	parsed, err := processor.ParseDigest(digestBytes)
+	require.NoError(t, err)
+	require.Equal(t, digest, parsed)
+
+	legacy, err := processor.ParseDigest([]byte("BigPotato/index.html\nBigPotato/post_processor.sh"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"BigPotato/index.html", "BigPotato/post_processor.sh"}, legacy.Paths())
+}
+
+func TestDigestFileIsModified(t *testing.T) {
+	outputRoot := t.TempDir()
+	writeFiles(t, outputRoot, map[string]string{
+		"same.txt":    "generated",
+		"changed.txt": "edited",
+	})
+
+	testCases := []struct {
+		file             processor.DigestFile
+		expectedModified bool
+	}{
+		{processor.DigestFile{Path: "same.txt", SHA256: processor.HashBytes([]byte("generated"))}, false},
+		{processor.DigestFile{Path: "changed.txt", SHA256: processor.HashBytes([]byte("generated"))}, true},
+		{processor.DigestFile{Path: "missing.txt", SHA256: processor.HashBytes([]byte("generated"))}, false},
+		{processor.DigestFile{Path: "changed.txt"}, false},
+	}
+
+	for _, testCase := range testCases {
+		isModified, err := testCase.file.IsModified(outputRoot, os.ReadFile)
+		require.NoError(t, err)
+		require.Equal(t, testCase.expectedModified, isModified, testCase.file.Path)
+	}
+}
+
+func TestHashParams(t *testing.T) {
+	hash1, err := processor.HashParams(processor.Params{"a": 1, "b": "two"})
+	require.NoError(t, err)
+	hash2, err := processor.HashParams(processor.Params{"b": "two", "a": 1})
+	require.NoError(t, err)
+	require.Equal(t, hash1, hash2)
+}
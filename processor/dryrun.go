@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DryRun compares rendered output with the current contents of the output
+// directory, and writes a unified diff to out for each file that a real run
+// would create, modify or delete, followed by a summary. previousPaths are
+// the digest entries from the previous run, relative to outputRoot, and
+// skipFiles are those the run would leave in place, as they were modified by
+// the user. If update is true, existing files are compared with the result of
+// merging them with the new output, as an update would do. Nothing is written
+// to disk.
+func DryRun(
+	out io.Writer,
+	outputRoot string,
+	absDigestPath string,
+	previousPaths []string,
+	skipFiles map[string]DigestFile,
+	update bool,
+	outputContents map[string]OutputFile,
+	readFileFn func(string) ([]byte, error),
+) []error {
+	var errs []error
+	addError := func(s string, args ...any) {
+		errs = append(errs, fmt.Errorf(s, args...))
+	}
+
+	baseRenderDir := BaseRenderDir(absDigestPath)
+	var newCount, modifiedCount, deletedCount, unchangedCount int
+
+	for _, path := range slices.Sorted(maps.Keys(outputContents)) {
+		relPath := SafeCutPrefix(path, outputRoot)
+		generated := outputContents[path].Content
+		if _, isSkipped := skipFiles[relPath]; isSkipped {
+			fmt.Fprintf(out, "keeping user-modified file %s\n", path)
+			continue
+		}
+
+		current, err := readFileFn(path)
+		if os.IsNotExist(err) {
+			writeDiff(out, nil, generated, "/dev/null", "b/"+relPath)
+			newCount++
+			continue
+		}
+		if err != nil {
+			addError("error reading output file %s: %s", path, err.Error())
+			continue
+		}
+
+		if update {
+			var conflicts int
+			generated, conflicts, err = mergeWithCurrent(outputRoot, baseRenderDir, path, generated, readFileFn)
+			if err != nil {
+				addError("error merging output file %s: %s", path, err.Error())
+				continue
+			}
+			if conflicts > 0 {
+				fmt.Fprintf(out, "merging %s would produce %d conflicts\n", path, conflicts)
+			}
+		}
+
+		if bytes.Equal(current, generated) {
+			unchangedCount++
+			continue
+		}
+		writeDiff(out, current, generated, "a/"+relPath, "b/"+relPath)
+		modifiedCount++
+	}
+
+	for _, relPath := range previousPaths {
+		path := filepath.Join(outputRoot, relPath)
+		if relPath == "" {
+			continue
+		}
+		if _, willWrite := outputContents[path]; willWrite {
+			continue
+		}
+		if _, isSkipped := skipFiles[relPath]; isSkipped {
+			fmt.Fprintf(out, "keeping user-modified file %s\n", path)
+			continue
+		}
+		if update && !MatchesBaseRender(outputRoot, baseRenderDir, relPath, readFileFn) {
+			continue
+		}
+
+		current, err := readFileFn(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			addError("error reading output file %s: %s", path, err.Error())
+			continue
+		}
+		writeDiff(out, current, nil, "a/"+relPath, "/dev/null")
+		deletedCount++
+	}
+
+	fmt.Fprintf(out, "dry run: %d new, %d modified, %d deleted, %d unchanged\n",
+		newCount, modifiedCount, deletedCount, unchangedCount)
+	return errs
+}
+
+func writeDiff(out io.Writer, from []byte, to []byte, fromLabel string, toLabel string) {
+	if bytes.IndexByte(from, 0) >= 0 || bytes.IndexByte(to, 0) >= 0 {
+		fmt.Fprintf(out, "Binary files %s and %s differ\n", fromLabel, toLabel)
+		return
+	}
+
+	diff := difflib.UnifiedDiff{
+		A:        diffLines(from),
+		B:        diffLines(to),
+		FromFile: fromLabel,
+		ToFile:   toLabel,
+		Context:  3,
+	}
+	// Writes to out can only fail if out itself fails, which a dry run has no
+	// way to recover from anyway.
+	_ = difflib.WriteUnifiedDiff(out, diff)
+}
+
+// diffLines splits content into lines for diffing. Every line must end with a
+// newline, for the diff to be printed correctly.
+func diffLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := splitLines(content)
+	last := len(lines) - 1
+	if lines[last][len(lines[last])-1] != '\n' {
+		lines[last] += "\n"
+	}
+	return lines
+}
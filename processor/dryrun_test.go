@@ -0,0 +1,70 @@
+package processor_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestDryRun(t *testing.T) {
+	outputRoot := t.TempDir() + "/"
+	writeFiles(t, outputRoot, map[string]string{
+		"modified.txt":  "a\nb\nc\n",
+		"unchanged.txt": "same\n",
+		"stale.txt":     "old\n",
+	})
+
+	outputContents := map[string]processor.OutputFile{
+		filepath.Join(outputRoot, "modified.txt"):  {Content: []byte("a\nB\nc\n")},
+		filepath.Join(outputRoot, "unchanged.txt"): {Content: []byte("same\n")},
+		filepath.Join(outputRoot, "new.txt"):       {Content: []byte("new")},
+	}
+
+	var output bytes.Buffer
+	errs := processor.DryRun(
+		&output,
+		outputRoot,
+		filepath.Join(outputRoot, "digest.txt"),
+		[]string{"modified.txt", "unchanged.txt", "stale.txt"},
+		nil,
+		false,
+		outputContents,
+		os.ReadFile,
+	)
+	require.Empty(t, errs)
+
+	require.Equal(t, `--- a/modified.txt
++++ b/modified.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++new
+--- a/stale.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+dry run: 1 new, 1 modified, 1 deleted, 1 unchanged
+`, output.String())
+
+	// Nothing was written.
+	_, err := os.Stat(filepath.Join(outputRoot, "new.txt"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
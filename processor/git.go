@@ -0,0 +1,261 @@
+package processor
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitSource is a template config inside a git repository, pinned to a ref.
+// It's written as <repo URL>//<path in repo>@<ref>, e.g.
+// file:///path/to/repo.git//subdir/config.hjson@v1.4.0. If the @<ref> is
+// omitted, HEAD is used.
+type GitSource struct {
+	RepoURL    string
+	ConfigPath string
+	Ref        string
+}
+
+// IsGitSource reports whether a --source-config value refers to a git
+// repository, rather than a file on the local filesystem.
+func IsGitSource(s string) bool {
+	return strings.Contains(s, "://")
+}
+
+// ParseGitSource splits a git source into its parts.
+func ParseGitSource(s string) (GitSource, error) {
+	schemeEnd := strings.Index(s, "://")
+	if schemeEnd < 0 {
+		return GitSource{}, fmt.Errorf("git source %q has no URL scheme", s)
+	}
+
+	// The scheme is followed by "//", and so is the repo URL. Skip the third
+	// slash of "file:///" URLs, which is the root of the repo's path.
+	afterScheme := schemeEnd + len("://") + 1
+	sepIndex := strings.Index(s[afterScheme:], "//")
+	if sepIndex < 0 {
+		return GitSource{}, fmt.Errorf("git source %q has no //path/to/config inside the repository", s)
+	}
+	repoURL := s[:afterScheme+sepIndex]
+	configPath := s[afterScheme+sepIndex+len("//"):]
+
+	ref := "HEAD"
+	if atIndex := strings.LastIndex(configPath, "@"); atIndex >= 0 {
+		ref = configPath[atIndex+1:]
+		configPath = configPath[:atIndex]
+	}
+
+	if configPath == "" || ref == "" {
+		return GitSource{}, fmt.Errorf("git source %q must name a config file and, if given, a nonempty ref", s)
+	}
+	return GitSource{
+		RepoURL:    repoURL,
+		ConfigPath: filepath.Clean(configPath),
+		Ref:        ref,
+	}, nil
+}
+
+// Fetch makes the repository's tree at the source's ref available on the
+// local filesystem, beneath cacheDir. It returns the local path of the config
+// file, and the commit the ref resolved to.
+//
+// The repository is mirrored into cacheDir, and refreshed on every call, so
+// that moved branches and tags are picked up. Each commit's tree is
+// extracted once, and reused afterwards.
+func (g GitSource) Fetch(cacheDir string) (string, string, error) {
+	urlHash := sha256.Sum256([]byte(g.RepoURL))
+	mirrorDir := filepath.Join(cacheDir, "git", "repos", hex.EncodeToString(urlHash[:8])+".git")
+
+	_, err := os.Stat(mirrorDir)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(mirrorDir), 0755)
+		if err != nil {
+			return "", "", err
+		}
+		_, err = runGit("", "clone", "--quiet", "--mirror", g.RepoURL, mirrorDir)
+	} else if err == nil {
+		_, err = runGit(mirrorDir, "fetch", "--quiet", "--prune", "origin")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error mirroring %s: %s", g.RepoURL, err.Error())
+	}
+
+	commitBytes, err := runGit(mirrorDir, "rev-parse", "--verify", "--quiet", g.Ref+"^{commit}")
+	if err != nil {
+		return "", "", fmt.Errorf("ref %q not found in %s", g.Ref, g.RepoURL)
+	}
+	commit := strings.TrimSpace(string(commitBytes))
+
+	treeDir := filepath.Join(cacheDir, "git", "trees", commit)
+	_, err = os.Stat(treeDir)
+	if os.IsNotExist(err) {
+		err = extractGitTree(mirrorDir, commit, treeDir)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("error extracting commit %s of %s: %s", commit, g.RepoURL, err.Error())
+	}
+
+	return filepath.Join(treeDir, g.ConfigPath), commit, nil
+}
+
+// extractGitTree writes the tree of a commit into treeDir. It's extracted to a
+// temporary directory first, so that an interrupted extraction never leaves
+// a partial tree in the cache.
+func extractGitTree(mirrorDir string, commit string, treeDir string) error {
+	archive, err := runGit(mirrorDir, "archive", "--format=tar", commit)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(treeDir), 0755)
+	if err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(treeDir), commit+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	err = extractTar(bytes.NewReader(archive), tmpDir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, treeDir)
+}
+
+// extractTar writes the files of a tar archive into destDir. The template's
+// files are read through its links, so a link out of the tree could copy any
+// local file into the output. Links are only checked lexically, so a link may
+// not pass through another link, which could lead anywhere, and nothing may
+// be extracted beneath a link.
+func extractTar(r io.Reader, destDir string) error {
+	// links are the archive's links, and traversed maps each path which a
+	// link passes through to the link.
+	links := map[string]bool{}
+	traversed := map[string]string{}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("archive entry %q is outside the archive root", header.Name)
+		}
+		path := filepath.Join(destDir, name)
+		for parent := name; parent != "."; parent = filepath.Dir(parent) {
+			if links[parent] {
+				return fmt.Errorf("archive entry %q is beneath the link %q", header.Name, parent)
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+			if err == nil {
+				err = writeTarFile(tr, path, header.FileInfo().Mode().Perm())
+			}
+		case tar.TypeSymlink:
+			if link, isTraversed := traversed[name]; isTraversed {
+				return fmt.Errorf("archive entry %q is a link, which the link %q passes through", header.Name, link)
+			}
+			passes, linkErr := linkPath(name, header.Linkname, links)
+			if linkErr != nil {
+				return linkErr
+			}
+			for _, passed := range passes {
+				traversed[passed] = name
+			}
+			links[name] = true
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+			if err == nil {
+				err = os.Symlink(header.Linkname, path)
+			}
+		default:
+			// Other entries, like git's pax headers, carry no files.
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// linkPath returns the paths, relative to the archive root, which the link
+// name passes through to reach target, one component at a time. It's an
+// error for the link to leave the archive root, or pass through one of links.
+func linkPath(name string, target string, links map[string]bool) ([]string, error) {
+	if filepath.IsAbs(target) {
+		return nil, fmt.Errorf("archive entry %q links to %q, outside the archive root", name, target)
+	}
+	var components []string
+	if dir := filepath.Dir(name); dir != "." {
+		components = strings.Split(dir, string(filepath.Separator))
+	}
+	var passes []string
+	for _, component := range strings.Split(filepath.ToSlash(target), "/") {
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if len(components) == 0 {
+				return nil, fmt.Errorf("archive entry %q links to %q, outside the archive root", name, target)
+			}
+			components = components[:len(components)-1]
+			continue
+		}
+		components = append(components, component)
+		passed := filepath.Join(components...)
+		if links[passed] {
+			return nil, fmt.Errorf("archive entry %q links to %q, through the link %q", name, target, passed)
+		}
+		passes = append(passes, passed)
+	}
+	return passes, nil
+}
+
+func writeTarFile(r io.Reader, path string, mode os.FileMode) (err error) {
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if c := w.Close(); err == nil {
+			err = c
+		}
+	}()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// runGit runs a git command, optionally inside a bare repository, and
+// returns its stdout.
+func runGit(gitDir string, args ...string) ([]byte, error) {
+	if gitDir != "" {
+		args = append([]string{"--git-dir", gitDir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %s: %s", strings.Join(args, " "), err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	return stdout, nil
+}
@@ -0,0 +1,154 @@
+package processor_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestParseGitSource(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected processor.GitSource
+	}{
+		{
+			"file:///path/to/repo.git//subdir/config.hjson@v1.4.0",
+			processor.GitSource{"file:///path/to/repo.git", "subdir/config.hjson", "v1.4.0"},
+		},
+		{
+			"https://example.com/org/repo.git//config.hjson",
+			processor.GitSource{"https://example.com/org/repo.git", "config.hjson", "HEAD"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.source, func(t *testing.T) {
+			require.True(t, processor.IsGitSource(tc.source))
+			source, err := processor.ParseGitSource(tc.source)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, source)
+		})
+	}
+
+	require.False(t, processor.IsGitSource("templates/config.hjson"))
+
+	_, err := processor.ParseGitSource("file:///path/to/repo.git")
+	require.Error(t, err)
+	_, err = processor.ParseGitSource("file:///path/to/repo.git//config.hjson@")
+	require.Error(t, err)
+}
+
+func TestGitSourceFetch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	workDir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = workDir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_SYSTEM=/dev/null")
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+
+	git("init", "--quiet")
+	writeFiles(t, workDir, map[string]string{
+		"templates/config.hjson":     "{}",
+		"templates/files/README.txt": "v1",
+	})
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "v1")
+	git("tag", "v1")
+	v1Commit := git("rev-parse", "HEAD")
+
+	writeFiles(t, workDir, map[string]string{
+		"templates/files/README.txt": "v2",
+	})
+	git("commit", "--quiet", "-am", "v2")
+	v2Commit := git("rev-parse", "HEAD")
+
+	cacheDir := t.TempDir()
+	source, err := processor.ParseGitSource("file://" + workDir + "//templates/config.hjson@v1")
+	require.NoError(t, err)
+
+	configPath, commit, err := source.Fetch(cacheDir)
+	require.NoError(t, err)
+	require.Equal(t, v1Commit, commit)
+	require.Equal(t, filepath.Join(cacheDir, "git", "trees", v1Commit, "templates/config.hjson"), configPath)
+
+	readme, err := os.ReadFile(filepath.Join(filepath.Dir(configPath), "files/README.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(readme))
+
+	// Moving the tag is picked up by the next fetch.
+	git("tag", "-f", "v1", v2Commit)
+	configPath, commit, err = source.Fetch(cacheDir)
+	require.NoError(t, err)
+	require.Equal(t, v2Commit, commit)
+
+	readme, err = os.ReadFile(filepath.Join(filepath.Dir(configPath), "files/README.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(readme))
+
+	source.Ref = "v9"
+	_, _, err = source.Fetch(cacheDir)
+	require.Error(t, err)
+
+	// Links within the tree are kept, but links out of it are refused.
+	require.NoError(t, os.Symlink("README.txt", filepath.Join(workDir, "templates/files/link.txt")))
+	git("add", "-A")
+	git("commit", "--quiet", "-m", "link")
+	git("tag", "v3")
+	source.Ref = "v3"
+	configPath, _, err = source.Fetch(cacheDir)
+	require.NoError(t, err)
+	link, err := os.ReadFile(filepath.Join(filepath.Dir(configPath), "files/link.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(link))
+
+	for i, target := range []string{"/etc/passwd", "../../../secret"} {
+		require.NoError(t, os.Symlink(target, filepath.Join(workDir, "templates/files/secret")))
+		git("add", "-A")
+		git("commit", "--quiet", "-m", "secret")
+		tag := fmt.Sprintf("secret%d", i)
+		git("tag", tag)
+		require.NoError(t, os.Remove(filepath.Join(workDir, "templates/files/secret")))
+
+		source.Ref = tag
+		_, _, err = source.Fetch(cacheDir)
+		require.ErrorContains(t, err, "outside the archive root")
+	}
+
+	// A link through another link could lead anywhere, although it looks
+	// like it stays in the tree. Here, <dir>/deep is templates, so the leak
+	// climbs to / and reads /etc/passwd. The archive lists templates/a before
+	// the leak, and templates/sub after it.
+	for _, dir := range []string{"sub", "a"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(workDir, "templates", dir), 0755))
+		require.NoError(t, os.Symlink("..", filepath.Join(workDir, "templates", dir, "deep")))
+		target := "../" + strings.Repeat(dir+"/deep/", 20) + strings.Repeat("../", 40) + "etc/passwd"
+		require.NoError(t, os.Symlink(target, filepath.Join(workDir, "templates/files/leak")))
+		git("add", "-A")
+		git("commit", "--quiet", "-m", "leak")
+		tag := "leak-" + dir
+		git("tag", tag)
+		require.NoError(t, os.RemoveAll(filepath.Join(workDir, "templates", dir)))
+		require.NoError(t, os.Remove(filepath.Join(workDir, "templates/files/leak")))
+
+		source.Ref = tag
+		_, _, err = source.Fetch(cacheDir)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "templates/"+dir+"/deep")
+	}
+}
@@ -0,0 +1,217 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The files of a golden test case, in the case's directory.
+const (
+	GoldenParamsFile  = "params.hjson"
+	GoldenExpectedDir = "expected"
+)
+
+// GoldenCase is a golden test case of a template: a directory holding the
+// params to render the template with, in params.hjson, and the output it's
+// expected to render, beneath expected/. Dir is the path of the directory.
+type GoldenCase struct {
+	Name   string
+	Dir    string
+	Params Params
+}
+
+// RenderFunc renders a template with params, returning each output file keyed
+// by its path relative to the output directory.
+type RenderFunc func(params Params) (map[string]OutputFile, []error)
+
+// FindGoldenCases returns the golden test cases in the subdirectories of
+// testdataDir in fsys, sorted by name. Each subdirectory with a params.hjson
+// is a case. If its expected directory doesn't exist yet, no output is
+// expected.
+func FindGoldenCases(fsys fs.FS, testdataDir string) ([]GoldenCase, error) {
+	entries, err := fs.ReadDir(fsys, testdataDir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing test cases in %s: %s", testdataDir, err.Error())
+	}
+
+	var cases []GoldenCase
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		caseDir := path.Join(testdataDir, entry.Name())
+		loader := MakeFileLoader(fsys, caseDir, ".")
+		var params Params
+		err := loader.LoadFile(GoldenParamsFile, &params)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error loading params of test case %s: %s", caseDir, err.Error())
+		}
+		cases = append(cases, GoldenCase{entry.Name(), caseDir, params})
+	}
+	return cases, nil
+}
+
+// CompareGolden compares rendered output, keyed by paths relative to the
+// output directory, with the expected tree beneath expectedDir in fsys. It
+// writes a unified diff to out for each file whose content differs, which
+// wasn't rendered, or which wasn't expected, and a note for each file whose
+// mode differs, then returns the number of files which differ. Only the
+// executable bits of modes are compared, since those are all that git keeps.
+func CompareGolden(out io.Writer, outputContents map[string]OutputFile, fsys fs.FS, expectedDir string) (int, error) {
+	expectedPaths, err := FindFiles(fsys, expectedDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		expectedPaths, err = nil, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error listing expected files in %s: %s", expectedDir, err.Error())
+	}
+
+	expected := map[string]string{}
+	for _, expectedPath := range expectedPaths {
+		expected[SafeCutPrefix(expectedPath, expectedDir)] = expectedPath
+	}
+	rendered := map[string]OutputFile{}
+	for relPath, outputFile := range outputContents {
+		rendered[filepath.ToSlash(relPath)] = outputFile
+	}
+
+	var differences int
+	for _, relPath := range slices.Sorted(maps.Keys(rendered)) {
+		outputFile := rendered[relPath]
+		expectedPath, isExpected := expected[relPath]
+		if !isExpected {
+			writeDiff(out, nil, outputFile.Content, "/dev/null", "rendered/"+relPath)
+			differences++
+			continue
+		}
+
+		expectedContent, err := fs.ReadFile(fsys, expectedPath)
+		if err != nil {
+			return differences, fmt.Errorf("error reading expected file %s: %s", expectedPath, err.Error())
+		}
+		info, err := fs.Stat(fsys, expectedPath)
+		if err != nil {
+			return differences, fmt.Errorf("error reading mode of expected file %s: %s", expectedPath, err.Error())
+		}
+
+		isDifferent := false
+		if !bytes.Equal(expectedContent, outputFile.Content) {
+			writeDiff(out, expectedContent, outputFile.Content, "expected/"+relPath, "rendered/"+relPath)
+			isDifferent = true
+		}
+		expectedMode := info.Mode().Perm()
+		if expectedMode&0111 != outputFile.Mode&0111 {
+			fmt.Fprintf(out, "mode of %s differs: expected %04o, rendered %04o\n", relPath, expectedMode, outputFile.Mode)
+			isDifferent = true
+		}
+		if isDifferent {
+			differences++
+		}
+	}
+
+	for _, relPath := range slices.Sorted(maps.Keys(expected)) {
+		if _, isRendered := rendered[relPath]; isRendered {
+			continue
+		}
+		expectedContent, err := fs.ReadFile(fsys, expected[relPath])
+		if err != nil {
+			return differences, fmt.Errorf("error reading expected file %s: %s", expected[relPath], err.Error())
+		}
+		writeDiff(out, expectedContent, nil, "expected/"+relPath, "/dev/null")
+		differences++
+	}
+
+	return differences, nil
+}
+
+// WriteGolden replaces the expected tree at expectedDir with rendered output,
+// keyed by paths relative to the output directory.
+func WriteGolden(outputContents map[string]OutputFile, expectedDir string, outputFS OutputFS) error {
+	err := outputFS.RemoveAll(expectedDir)
+	if err != nil {
+		return fmt.Errorf("error removing expected files in %s: %s", expectedDir, err.Error())
+	}
+
+	for _, relPath := range slices.Sorted(maps.Keys(outputContents)) {
+		outputFile := outputContents[relPath]
+		expectedPath := filepath.Join(expectedDir, relPath)
+		err := outputFS.MkdirAll(filepath.Dir(expectedPath), 0755)
+		if err == nil {
+			err = outputFS.WriteFile(expectedPath, outputFile.Content, outputFile.Mode)
+		}
+		if err == nil {
+			err = outputFS.Chmod(expectedPath, outputFile.Mode)
+		}
+		if err != nil {
+			return fmt.Errorf("error writing expected file %s: %s", expectedPath, err.Error())
+		}
+	}
+	return nil
+}
+
+// CheckGolden runs the golden test cases in testdataDir, on the local
+// filesystem, as subtests of t. Each case fails with a diff between its
+// rendered and expected output. If update is true, each case's expected tree
+// is rewritten with its rendered output instead. For example:
+//
+//	var update = flag.Bool("update", false, "rewrite the expected output")
+//
+//	func TestTemplate(t *testing.T) {
+//		template, err := sprout.OpenTemplate("config.hjson", "")
+//		require.NoError(t, err)
+//		processor.CheckGolden(t, template.Renderer(1), "testdata", *update)
+//	}
+func CheckGolden(t *testing.T, render RenderFunc, testdataDir string, update bool) {
+	t.Helper()
+	fsys := os.DirFS(testdataDir)
+	cases, err := FindGoldenCases(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no test cases found in %s", testdataDir)
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			outputContents, errs := render(c.Params)
+			for _, err := range errs {
+				t.Error(err)
+			}
+			if len(errs) > 0 {
+				return
+			}
+
+			expectedDir := path.Join(c.Dir, GoldenExpectedDir)
+			if update {
+				err := WriteGolden(outputContents, filepath.Join(testdataDir, filepath.FromSlash(expectedDir)), DiskFS{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var diff strings.Builder
+			differences, err := CompareGolden(&diff, outputContents, fsys, expectedDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if differences > 0 {
+				t.Errorf("%d files differ from %s:\n%s", differences, filepath.Join(testdataDir, filepath.FromSlash(expectedDir)), diff.String())
+			}
+		})
+	}
+}
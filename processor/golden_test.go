@@ -0,0 +1,69 @@
+package processor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestGolden(t *testing.T) {
+	templateFS := processor.NewMemFS()
+	templateFS.WriteFile("testdata/basic/params.hjson", []byte("name: x\n"), 0644)
+	templateFS.WriteFile("testdata/basic/expected/same.txt", []byte("same\n"), 0644)
+	templateFS.WriteFile("testdata/basic/expected/content.txt", []byte("old\n"), 0644)
+	templateFS.WriteFile("testdata/basic/expected/bin/run.sh", []byte("run\n"), 0644)
+	templateFS.WriteFile("testdata/basic/expected/missing.txt", []byte("missing\n"), 0644)
+	templateFS.WriteFile("testdata/new/params.hjson", []byte("name: y\n"), 0644)
+	templateFS.WriteFile("testdata/notes.txt", []byte("not a case"), 0644)
+	templateFS.WriteFile("testdata/other/README", []byte("not a case either"), 0644)
+
+	cases, err := processor.FindGoldenCases(templateFS, "testdata")
+	require.NoError(t, err)
+	require.Equal(t, []processor.GoldenCase{
+		{"basic", "testdata/basic", processor.Params{"name": "x"}},
+		{"new", "testdata/new", processor.Params{"name": "y"}},
+	}, cases)
+
+	outputContents := map[string]processor.OutputFile{
+		"same.txt":    {Content: []byte("same\n"), Mode: 0644},
+		"content.txt": {Content: []byte("new\n"), Mode: 0644},
+		"bin/run.sh":  {Content: []byte("run\n"), Mode: 0755},
+		"extra.txt":   {Content: []byte("extra\n"), Mode: 0644},
+	}
+	var diff strings.Builder
+	differences, err := processor.CompareGolden(&diff, outputContents, templateFS, "testdata/basic/expected")
+	require.NoError(t, err)
+	require.Equal(t, 4, differences)
+	require.Equal(t, `mode of bin/run.sh differs: expected 0644, rendered 0755
+--- expected/content.txt
++++ rendered/content.txt
+@@ -1 +1 @@
+-old
++new
+--- /dev/null
++++ rendered/extra.txt
+@@ -0,0 +1 @@
++extra
+--- expected/missing.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-missing
+`, diff.String())
+
+	// A case with no expected directory expects no output.
+	diff.Reset()
+	differences, err = processor.CompareGolden(&diff, outputContents, templateFS, "testdata/new/expected")
+	require.NoError(t, err)
+	require.Equal(t, 4, differences)
+
+	// Once the expected tree is rewritten, there are no differences.
+	outputFS := processor.NewMemOutputFS()
+	require.NoError(t, outputFS.WriteFile("/testdata/basic/expected/missing.txt", []byte("missing\n"), 0644))
+	require.NoError(t, processor.WriteGolden(outputContents, "/testdata/basic/expected", outputFS))
+	diff.Reset()
+	differences, err = processor.CompareGolden(&diff, outputContents, outputFS.Files, "testdata/basic/expected")
+	require.NoError(t, err)
+	require.Equal(t, 0, differences, diff.String())
+}
@@ -0,0 +1,257 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The collection and logic helpers below are shared by the Go, Jet and Pongo
+// engines, so they take their arguments in the same order everywhere. The
+// value being operated on comes last, as in Go template pipelines, e.g.
+// {{ .names | Join ", " }} is the same as {{ Join(", ", .names) }} in Jet.
+
+// List returns its arguments as a list.
+func List(values ...any) []any {
+	return values
+}
+
+// Join formats each element of list, and joins them with sep.
+func Join(sep string, list any) (string, error) {
+	elements, err := toList("Join", list)
+	if err != nil {
+		return "", err
+	}
+	strs := make([]string, len(elements))
+	for i, element := range elements {
+		strs[i] = fmt.Sprint(element)
+	}
+	return strings.Join(strs, sep), nil
+}
+
+// Split splits s on each occurrence of sep.
+func Split(sep string, s string) []string {
+	return strings.Split(s, sep)
+}
+
+// Contains reports whether collection contains item: a substring of a
+// string, an element of a list, or a key of a map.
+func Contains(item any, collection any) (bool, error) {
+	if s, isString := collection.(string); isString {
+		substr, isString := item.(string)
+		if !isString {
+			return false, fmt.Errorf("Contains: can't look for %T in a string", item)
+		}
+		return strings.Contains(s, substr), nil
+	}
+
+	v := reflect.ValueOf(collection)
+	if v.Kind() == reflect.Map {
+		key, isString := item.(string)
+		if !isString || v.Type().Key().Kind() != reflect.String {
+			return false, fmt.Errorf("Contains: can't look for %T among the keys of %T", item, collection)
+		}
+		return v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).IsValid(), nil
+	}
+
+	elements, err := toList("Contains", collection)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(elements, func(element any) bool {
+		return valuesEqual(element, item)
+	}), nil
+}
+
+// Keys returns the keys of a map, sorted.
+func Keys(m any) ([]string, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("Keys: expected a map with string keys, got %T", m)
+	}
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// SortBy returns a list of maps, sorted by the value each one has for key.
+// The values must all be numbers, or all be strings. Maps with equal values
+// keep their order.
+func SortBy(key string, list any) ([]any, error) {
+	elements, err := toList("SortBy", list)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(elements))
+	for i, element := range elements {
+		m, isMap := toStringMap(element)
+		if !isMap {
+			return nil, fmt.Errorf("SortBy: element %d is a %T, not a map", i, element)
+		}
+		value, hasKey := m[key]
+		if !hasKey {
+			return nil, fmt.Errorf("SortBy: element %d has no key %q", i, key)
+		}
+		values[i] = value
+	}
+
+	indexes := make([]int, len(elements))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	var compareErr error
+	slices.SortStableFunc(indexes, func(a int, b int) int {
+		result, err := compareValues(values[a], values[b])
+		if err != nil && compareErr == nil {
+			compareErr = fmt.Errorf("SortBy: error comparing %q of elements %d and %d: %s", key, a, b, err.Error())
+		}
+		return result
+	})
+	if compareErr != nil {
+		return nil, compareErr
+	}
+
+	sorted := make([]any, len(elements))
+	for i, index := range indexes {
+		sorted[i] = elements[index]
+	}
+	return sorted, nil
+}
+
+// compareValues compares two numbers, or two strings.
+func compareValues(a any, b any) (int, error) {
+	aNum, aIsNumber := toFloat64(a)
+	bNum, bIsNumber := toFloat64(b)
+	if aIsNumber && bIsNumber {
+		switch {
+		case aNum < bNum:
+			return -1, nil
+		case aNum > bNum:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	aStr, aIsString := a.(string)
+	bStr, bIsString := b.(string)
+	if aIsString && bIsString {
+		return strings.Compare(aStr, bStr), nil
+	}
+	return 0, fmt.Errorf("can't compare %T with %T", a, b)
+}
+
+// Uniq returns the elements of list without duplicates, in the order each
+// first appears.
+func Uniq(list any) ([]any, error) {
+	elements, err := toList("Uniq", list)
+	if err != nil {
+		return nil, err
+	}
+	uniq := []any{}
+	for _, element := range elements {
+		isDuplicate := slices.ContainsFunc(uniq, func(seen any) bool {
+			return valuesEqual(seen, element)
+		})
+		if !isDuplicate {
+			uniq = append(uniq, element)
+		}
+	}
+	return uniq, nil
+}
+
+// Default returns value, or defaultValue if value is empty. See isEmpty.
+func Default(defaultValue any, value any) any {
+	if isEmpty(value) {
+		return defaultValue
+	}
+	return value
+}
+
+// Coalesce returns the first of values which isn't empty, or nil if they all
+// are. See isEmpty.
+func Coalesce(values ...any) any {
+	for _, value := range values {
+		if !isEmpty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+// Ternary returns trueValue if condition is true, and falseValue otherwise.
+func Ternary(trueValue any, falseValue any, condition bool) any {
+	if condition {
+		return trueValue
+	}
+	return falseValue
+}
+
+// isEmpty reports whether value is nil, false, zero, an empty string, or an
+// empty list or map.
+func isEmpty(value any) bool {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// ToJSON encodes value as JSON, on a single line.
+func ToJSON(value any) (string, error) {
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("ToJSON: %s", err.Error())
+	}
+	return string(jsonBytes), nil
+}
+
+// ToYAML encodes value as YAML, without a trailing newline, so it can be
+// passed to Indent or Nindent.
+func ToYAML(value any) (string, error) {
+	yamlBytes, err := yaml.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("ToYAML: %s", err.Error())
+	}
+	return strings.TrimSuffix(string(yamlBytes), "\n"), nil
+}
+
+// Indent indents each line of s by the given number of spaces.
+func Indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// Nindent is Indent, preceded by a newline. It's for indenting a block which
+// starts on the line after a template tag.
+func Nindent(spaces int, s string) string {
+	return "\n" + Indent(spaces, s)
+}
+
+// toList converts a slice or array of any type to a []any.
+func toList(funcName string, list any) ([]any, error) {
+	if elements, isList := list.([]any); isList {
+		return elements, nil
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s: expected a list, got %T", funcName, list)
+	}
+	elements := make([]any, v.Len())
+	for i := range elements {
+		elements[i] = v.Index(i).Interface()
+	}
+	return elements, nil
+}
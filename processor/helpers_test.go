@@ -0,0 +1,154 @@
+package processor_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestHelpers(t *testing.T) {
+	params := processor.Params{
+		"names":   []any{"b", "a", "b", "c"},
+		"ports":   []any{float64(80), float64(443), float64(80)},
+		"empty":   "",
+		"name":    "svc",
+		"enabled": true,
+		"labels":  map[string]any{"tier": "web", "app": "svc"},
+		"services": []any{
+			map[string]any{"name": "web", "order": float64(2)},
+			map[string]any{"name": "db", "order": float64(1)},
+			map[string]any{"name": "cache", "order": float64(2)},
+		},
+	}
+
+	testCases := []struct {
+		gotmpl   string
+		jet      string
+		pongo    string
+		expected string
+	}{
+		{
+			`{{ Join ", " .names }}`,
+			`{{ Join(", ", .names) }}`,
+			`{{ Join(", ", PARAMS.names) }}`,
+			"b, a, b, c",
+		},
+		{
+			`{{ Join "," .ports }}`,
+			`{{ Join(",", .ports) }}`,
+			`{{ Join(",", PARAMS.ports) }}`,
+			"80,443,80",
+		},
+		{
+			`{{ range Split "." "a.b.c" }}[{{ . }}]{{ end }}`,
+			`{{ range _, s := Split(".", "a.b.c") }}[{{ s }}]{{ end }}`,
+			`{% for s in Split(".", "a.b.c") %}[{{ s }}]{% endfor %}`,
+			"[a][b][c]",
+		},
+		{
+			`{{ Contains "a" .names }} {{ Contains "z" .names }} {{ Contains "vc" .name }} {{ Contains "app" .labels }} {{ Contains 443 .ports }}`,
+			`{{ Contains("a", .names) }} {{ Contains("z", .names) }} {{ Contains("vc", .name) }} {{ Contains("app", .labels) }} {{ Contains(443, .ports) }}`,
+			`{{ Contains("a", PARAMS.names)|lower }} {{ Contains("z", PARAMS.names)|lower }} {{ Contains("vc", PARAMS.name)|lower }} {{ Contains("app", PARAMS.labels)|lower }} {{ Contains(443, PARAMS.ports)|lower }}`,
+			"true false true true true",
+		},
+		{
+			`{{ Join "," (Keys .labels) }}`,
+			`{{ Join(",", Keys(.labels)) }}`,
+			`{{ Join(",", Keys(PARAMS.labels)) }}`,
+			"app,tier",
+		},
+		{
+			`{{ range SortBy "order" .services }}{{ .name }} {{ end }}`,
+			`{{ range _, s := SortBy("order", .services) }}{{ s["name"] }} {{ end }}`,
+			`{% for s in SortBy("order", PARAMS.services) %}{{ s.name }} {% endfor %}`,
+			"db web cache ",
+		},
+		{
+			`{{ Join "," (Uniq .names) }} {{ Join "," (Uniq .ports) }}`,
+			`{{ Join(",", Uniq(.names)) }} {{ Join(",", Uniq(.ports)) }}`,
+			`{{ Join(",", Uniq(PARAMS.names)) }} {{ Join(",", Uniq(PARAMS.ports)) }}`,
+			"b,a,c 80,443",
+		},
+		{
+			`{{ Default "none" .empty }} {{ Default "none" .name }} {{ Coalesce .empty "" "first" "second" }}`,
+			`{{ Default("none", .empty) }} {{ Default("none", .name) }} {{ Coalesce(.empty, "", "first", "second") }}`,
+			`{{ Default("none", PARAMS.empty) }} {{ Default("none", PARAMS.name) }} {{ Coalesce(PARAMS.empty, "", "first", "second") }}`,
+			"none svc first",
+		},
+		{
+			`{{ Ternary "on" "off" .enabled }}`,
+			`{{ Ternary("on", "off", .enabled) }}`,
+			`{{ Ternary("on", "off", PARAMS.enabled) }}`,
+			"on",
+		},
+		{
+			`{{ ToJSON (Dict "name" .name "ports" (Uniq .ports)) }}`,
+			`{{ ToJSON(Dict("name", .name, "ports", Uniq(.ports))) }}`,
+			`{{ ToJSON(Dict("name", PARAMS.name, "ports", Uniq(PARAMS.ports))) }}`,
+			`{"name":"svc","ports":[80,443]}`,
+		},
+		{
+			`labels:{{ Nindent 2 (ToYAML .labels) }}`,
+			`labels:{{ Nindent(2, ToYAML(.labels)) }}`,
+			`labels:{{ Nindent(2, ToYAML(PARAMS.labels)) }}`,
+			"labels:\n  app: svc\n  tier: web",
+		},
+		{
+			`{{ Indent 4 (ToYAML (List "a" 1)) }}`,
+			`{{ Indent(4, ToYAML(List("a", 1))) }}`,
+			`{{ Indent(4, ToYAML(List("a", 1))) }}`,
+			"    - a\n    - 1",
+		},
+	}
+
+	engines := []struct {
+		name        string
+		templateMgr func() processor.TemplateMgr
+		tmpl        func(i int) string
+		errTmpl     string
+	}{
+		{"gotmpl", processor.GoTemplateMgr, func(i int) string { return testCases[i].gotmpl }, `{{ Join "," .name }}`},
+		{"jet", processor.JetTemplateMgr, func(i int) string { return testCases[i].jet }, `{{ Join(",", .name) }}`},
+		{"pongo", processor.PongoTemplateMgr, func(i int) string { return testCases[i].pongo }, `{{ Join(",", PARAMS.name) }}`},
+	}
+
+	for _, engine := range engines {
+		t.Run(engine.name, func(t *testing.T) {
+			for i, testCase := range testCases {
+				templateMgr := engine.templateMgr()
+				tmpl := engine.tmpl(i)
+				require.NoError(t, templateMgr.ParseOne("test", []byte(tmpl)))
+
+				var output bytes.Buffer
+				err := templateMgr.Execute("test", params, &output)
+				require.NoError(t, err, tmpl)
+				require.Equal(t, testCase.expected, output.String(), tmpl)
+			}
+
+			// Errors from the helpers fail the template.
+			templateMgr := engine.templateMgr()
+			require.NoError(t, templateMgr.ParseOne("test", []byte(engine.errTmpl)))
+			err := templateMgr.Execute("test", params, &bytes.Buffer{})
+			require.ErrorContains(t, err, "Join: expected a list, got string")
+		})
+	}
+}
+
+func TestHelperErrors(t *testing.T) {
+	_, err := processor.SortBy("order", []any{
+		map[string]any{"order": float64(1)},
+		map[string]any{"order": "first"},
+	})
+	require.ErrorContains(t, err, "can't compare")
+
+	_, err = processor.SortBy("order", []any{map[string]any{"name": "web"}})
+	require.EqualError(t, err, `SortBy: element 0 has no key "order"`)
+
+	_, err = processor.Join(",", "abc")
+	require.EqualError(t, err, "Join: expected a list, got string")
+
+	_, err = processor.Keys([]any{"a"})
+	require.EqualError(t, err, "Keys: expected a map with string keys, got []interface {}")
+}
@@ -0,0 +1,253 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Hooks are commands run before and after the output is written, e.g. to
+// initialize a git repository, or to tidy and format generated code. Each
+// phase's steps run in order.
+type Hooks struct {
+	PreGenerate  []HookStep
+	PostGenerate []HookStep
+}
+
+// HookStep is a single command run by a hook.
+type HookStep struct {
+	// Name identifies the step in progress messages and results.
+	Name    string
+	Command string
+	Args    []string
+	// Dir is the directory to run the command in, relative to the output
+	// directory. If empty, the command runs in the output directory.
+	Dir string
+	// Env holds environment variables for the command, in addition to
+	// sprout's own environment.
+	Env map[string]string
+	// If is resolved like a value of Config.Conditions, and the step is
+	// skipped if it's false. If empty, the step always runs.
+	If string
+	// Timeout limits how long the command may run, as a duration like "30s".
+	// If empty, there's no limit.
+	Timeout string
+	// OnFailure says what to do if the command fails. If empty, HookAbort.
+	OnFailure HookFailurePolicy
+}
+
+// HookFailurePolicy says what to do when a hook step fails.
+type HookFailurePolicy string
+
+const (
+	// HookAbort stops the run, skipping the remaining steps. A failed
+	// PreGenerate step also stops the output from being written.
+	HookAbort HookFailurePolicy = "abort"
+	// HookContinue reports the failure, then carries on with the next step.
+	HookContinue HookFailurePolicy = "continue"
+)
+
+// HookResult describes a single hook step, as run by RunHooks.
+type HookResult struct {
+	Phase string
+	Name  string
+	// Skipped steps weren't run, because their If condition was false, or
+	// because hooks weren't allowed to run.
+	Skipped  bool
+	Output   []byte
+	Duration time.Duration
+	// Error describes why the step failed, or is empty if it succeeded.
+	Error string
+}
+
+// hookStep is a HookStep, with its condition, timeout and failure policy
+// parsed.
+type hookStep struct {
+	HookStep
+	enabled       bool
+	timeout       time.Duration
+	abortOnFailed bool
+}
+
+// ValidateHooks checks the Dir, If, Timeout and OnFailure values of every
+// step, so that a typo, or a Dir outside the output directory, is reported
+// before anything is run or written.
+func ValidateHooks(hooks Hooks) []error {
+	_, preErrs := parseHookSteps("PreGenerate", hooks.PreGenerate)
+	_, postErrs := parseHookSteps("PostGenerate", hooks.PostGenerate)
+	return append(preErrs, postErrs...)
+}
+
+func parseHookSteps(phase string, steps []HookStep) ([]hookStep, []error) {
+	var errs []error
+	addError := func(s string, args ...any) {
+		errs = append(errs, fmt.Errorf(s, args...))
+	}
+
+	var parsed []hookStep
+	for i, step := range steps {
+		name := hookStepName(phase, i, step)
+		if step.Command == "" {
+			addError("hook %s: Command is required and not defined", name)
+			continue
+		}
+		if step.Dir != "" && !filepath.IsLocal(step.Dir) {
+			addError("hook %s: Dir must be a relative path inside the output directory, got %q", name, step.Dir)
+			continue
+		}
+
+		enabled := true
+		if strings.TrimSpace(step.If) != "" {
+			var err error
+			enabled, err = parseCondition(step.If)
+			if err != nil {
+				addError("hook %s: If %s", name, err.Error())
+				continue
+			}
+		}
+
+		var timeout time.Duration
+		if step.Timeout != "" {
+			var err error
+			timeout, err = time.ParseDuration(step.Timeout)
+			if err != nil || timeout <= 0 {
+				addError("hook %s: Timeout must be a positive duration like \"30s\", got %q", name, step.Timeout)
+				continue
+			}
+		}
+
+		abortOnFailed := true
+		switch step.OnFailure {
+		case "", HookAbort:
+		case HookContinue:
+			abortOnFailed = false
+		default:
+			addError("hook %s: unrecognized OnFailure %q. expected %s or %s", name, step.OnFailure, HookAbort, HookContinue)
+			continue
+		}
+
+		step.Name = name
+		parsed = append(parsed, hookStep{step, enabled, timeout, abortOnFailed})
+	}
+	return parsed, errs
+}
+
+// hookStepName returns the step's name, or names it after its position and
+// command, if it has none.
+func hookStepName(phase string, i int, step HookStep) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s[%d] %s", phase, i, step.Command))
+}
+
+// RunHooks runs the steps of a hook phase, in order, in the output directory,
+// and returns the result of each. A failed step with the HookAbort policy
+// stops the remaining steps, and is returned as an error. Unless
+// autoRunHooks is true, nothing is run; the commands are only reported, for
+// the user to examine and run by hand. If sandbox isn't nil, it restricts the
+// commands.
+func RunHooks(
+	ctx context.Context,
+	phase string,
+	steps []HookStep,
+	outputRoot string,
+	autoRunHooks bool,
+	sandbox *Sandbox,
+	logf Logf,
+) ([]HookResult, []error) {
+	parsed, errs := parseHookSteps(phase, steps)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	absOutputRoot, err := filepath.Abs(outputRoot)
+	if err != nil {
+		return nil, []error{fmt.Errorf("error finding absolute path of %q: %s", outputRoot, err.Error())}
+	}
+
+	var results []HookResult
+	for _, step := range parsed {
+		result := HookResult{Phase: phase, Name: step.Name}
+		dir := filepath.Join(absOutputRoot, step.Dir)
+		commandLine := strings.Join(append([]string{step.Command}, step.Args...), " ")
+
+		if !step.enabled {
+			logf("skipping %s hook %q, since its condition is false", phase, step.Name)
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+		if !autoRunHooks {
+			logf(`
+!!!! MANUAL STEP !!!!
+%s hook %q was not run. Examine it for safety, then run it in %s if you're comfortable:
+
+    %s
+`, phase, step.Name, dir, commandLine)
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+
+		stepCtx, cancel := ctx, context.CancelFunc(func() {})
+		if step.timeout > 0 {
+			stepCtx, cancel = context.WithTimeout(ctx, step.timeout)
+		}
+
+		logf("running %s hook %q: %s", phase, step.Name, commandLine)
+		var env []string
+		for _, key := range slices.Sorted(maps.Keys(step.Env)) {
+			env = append(env, key+"="+step.Env[key])
+		}
+		cmd, cleanup, err := sandbox.command(stepCtx, absOutputRoot, step.Command, step.Args, dir, env, logf)
+		// In a sandbox, hooks may only run declared commands, not scripts.
+		if err == nil && sandbox != nil && strings.ContainsRune(step.Command, filepath.Separator) {
+			cleanup()
+			err = fmt.Errorf("command %q must be one of the template's declared commands", step.Command)
+		}
+		if err != nil {
+			cancel()
+			err = fmt.Errorf("error running %s hook %q: %s", phase, step.Name, err.Error())
+			result.Error = err.Error()
+			return append(results, result), []error{err}
+		}
+		// Don't wait indefinitely for the output of any processes the
+		// command started, once it's killed.
+		cmd.WaitDelay = time.Second
+
+		output := newLogWriter(logf, step.Name+": ")
+		cmd.Stdout = output
+		cmd.Stderr = output
+
+		start := time.Now()
+		err = cmd.Run()
+		output.Flush()
+		cleanup()
+		result.Duration = time.Since(start)
+		result.Output = output.Output
+		if errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", step.timeout)
+		}
+		cancel()
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+
+		if err == nil {
+			continue
+		}
+		if !step.abortOnFailed {
+			logf("%s hook %q failed, continuing: %s", phase, step.Name, err.Error())
+			continue
+		}
+		return results, []error{fmt.Errorf("error running %s hook %q: %s", phase, step.Name, err.Error())}
+	}
+	return results, nil
+}
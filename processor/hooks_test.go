@@ -0,0 +1,67 @@
+package processor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestRunHooks(t *testing.T) {
+	outputRoot := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(outputRoot, "sub"), 0755))
+
+	steps := []processor.HookStep{
+		{Name: "env", Command: "sh", Args: []string{"-c", "echo $GREETING; pwd"}, Dir: "sub", Env: map[string]string{"GREETING": "hello"}},
+		{Name: "disabled", Command: "false", If: "False"},
+		{Name: "flaky", Command: "false", OnFailure: processor.HookContinue},
+		{Name: "slow", Command: "sleep", Args: []string{"5"}, Timeout: "100ms"},
+		{Name: "never", Command: "true"},
+	}
+
+	results, errs := processor.RunHooks(context.Background(), "PostGenerate", steps, outputRoot, true, nil, processor.Printfln)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], `error running PostGenerate hook "slow": timed out after 100ms`)
+
+	require.Len(t, results, 4)
+	require.Equal(t, "env", results[0].Name)
+	require.Equal(t, "hello\n"+filepath.Join(outputRoot, "sub")+"\n", string(results[0].Output))
+	require.Empty(t, results[0].Error)
+	require.True(t, results[1].Skipped)
+	require.Equal(t, "exit status 1", results[2].Error)
+	require.Equal(t, "timed out after 100ms", results[3].Error)
+
+	// Without permission to run hooks, every step is skipped.
+	results, errs = processor.RunHooks(context.Background(), "PostGenerate", steps, outputRoot, false, nil, processor.Printfln)
+	require.Empty(t, errs)
+	require.Len(t, results, 5)
+	for _, result := range results {
+		require.True(t, result.Skipped)
+	}
+}
+
+func TestValidateHooks(t *testing.T) {
+	errs := processor.ValidateHooks(processor.Hooks{
+		PreGenerate: []processor.HookStep{
+			{Name: "init", Command: "git", Args: []string{"init"}, If: "{{ .git }}"},
+			{Command: ""},
+		},
+		PostGenerate: []processor.HookStep{
+			{Command: "gofmt", Timeout: "soon"},
+			{Command: "go", OnFailure: "retry"},
+			{Command: "make", Dir: "../../.."},
+			{Command: "make", Dir: "/etc"},
+			{Command: "make", Dir: "sub/dir"},
+		},
+	})
+	require.Len(t, errs, 6)
+	require.EqualError(t, errs[0], `hook init: If must resolve to true or false, got "{{ .git }}"`)
+	require.EqualError(t, errs[1], `hook PreGenerate[1]: Command is required and not defined`)
+	require.EqualError(t, errs[2], `hook PostGenerate[0] gofmt: Timeout must be a positive duration like "30s", got "soon"`)
+	require.EqualError(t, errs[3], `hook PostGenerate[1] go: unrecognized OnFailure "retry". expected abort or continue`)
+	require.EqualError(t, errs[4], `hook PostGenerate[2] make: Dir must be a relative path inside the output directory, got "../../.."`)
+	require.EqualError(t, errs[5], `hook PostGenerate[3] make: Dir must be a relative path inside the output directory, got "/etc"`)
+}
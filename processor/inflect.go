@@ -0,0 +1,372 @@
+package processor
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Words splits an identifier or phrase in any case into its words. Words are
+// separated by any run of characters which aren't letters or digits, and by
+// changes of case: "HTTPServer", "http_server", "http-server" and
+// "Http Server" all split into "HTTP"/"http" and "Server"/"server". Digits
+// stay with the word before them, so "v2Api" splits into "v2" and "Api", and
+// so does the "s" of a plural acronym, so "userIDs" splits into "user" and
+// "IDs".
+func Words(s string) []string {
+	var words []string
+	for _, span := range wordSpans(s) {
+		words = append(words, s[span[0]:span[1]])
+	}
+	return words
+}
+
+// wordSpans returns the start and end indexes of each word in s. See Words.
+func wordSpans(s string) [][2]int {
+	var spans [][2]int
+	runes := []rune(s)
+	offsets := make([]int, len(runes)+1)
+	for i, offset := 0, 0; i < len(runes); i++ {
+		offsets[i] = offset
+		offset += utf8.RuneLen(runes[i])
+		offsets[i+1] = offset
+	}
+
+	start := -1
+	for i, r := range runes {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if !isWordRune {
+			if start >= 0 {
+				spans = append(spans, [2]int{offsets[start], offsets[i]})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			continue
+		}
+
+		// Split before an upper case letter which follows a lower case
+		// letter or a digit ("httpServer", "v2Api"), or which starts a
+		// word after an acronym ("HTTPServer"), rather than ending a plural
+		// acronym ("APIsList").
+		prev := runes[i-1]
+		isBoundary := false
+		if unicode.IsUpper(r) {
+			isPluralAcronym := i+1 < len(runes) && runes[i+1] == 's' &&
+				(i+2 == len(runes) || !unicode.IsLower(runes[i+2]))
+			isBoundary = unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && !isPluralAcronym)
+		}
+		if isBoundary {
+			spans = append(spans, [2]int{offsets[start], offsets[i]})
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{offsets[start], offsets[len(runes)]})
+	}
+	return spans
+}
+
+// capitalize upper-cases the first letter of word, and lower-cases the rest.
+func capitalize(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(first)) + strings.ToLower(word[size:])
+}
+
+// joinWords converts each word of s with convert, then joins them with sep.
+func joinWords(s string, sep string, convert func(i int, word string) string) string {
+	words := Words(s)
+	for i, word := range words {
+		words[i] = convert(i, word)
+	}
+	return strings.Join(words, sep)
+}
+
+// CamelCase converts s from any case to camelCase, e.g. "HTTPServer" becomes
+// "httpServer".
+func CamelCase(s string) string {
+	return joinWords(s, "", func(i int, word string) string {
+		if i == 0 {
+			return strings.ToLower(word)
+		}
+		return capitalize(word)
+	})
+}
+
+// PascalCase converts s from any case to PascalCase, e.g. "http_server"
+// becomes "HttpServer".
+func PascalCase(s string) string {
+	return joinWords(s, "", func(i int, word string) string {
+		return capitalize(word)
+	})
+}
+
+// SnakeCase converts s from any case to snake_case, e.g. "HTTPServer" becomes
+// "http_server".
+func SnakeCase(s string) string {
+	return joinWords(s, "_", func(i int, word string) string {
+		return strings.ToLower(word)
+	})
+}
+
+// ScreamingSnakeCase converts s from any case to SCREAMING_SNAKE_CASE, e.g.
+// "httpServer" becomes "HTTP_SERVER".
+func ScreamingSnakeCase(s string) string {
+	return joinWords(s, "_", func(i int, word string) string {
+		return strings.ToUpper(word)
+	})
+}
+
+// KebabCase converts s from any case to kebab-case, e.g. "HTTPServer" becomes
+// "http-server".
+func KebabCase(s string) string {
+	return joinWords(s, "-", func(i int, word string) string {
+		return strings.ToLower(word)
+	})
+}
+
+// DotCase converts s from any case to dot.case, e.g. "HTTPServer" becomes
+// "http.server".
+func DotCase(s string) string {
+	return joinWords(s, ".", func(i int, word string) string {
+		return strings.ToLower(word)
+	})
+}
+
+// TitleCase converts s from any case to Title Case, e.g. "http_server" becomes
+// "Http Server". Acronyms keep their case, so "HTTPServer" becomes
+// "HTTP Server", and "userIDs" becomes "User IDs".
+func TitleCase(s string) string {
+	return joinWords(s, " ", func(i int, word string) string {
+		acronym := strings.TrimSuffix(word, "s")
+		if acronym != "" && strings.ToUpper(acronym) == acronym {
+			return word
+		}
+		return capitalize(word)
+	})
+}
+
+// Irregular and uncountable nouns, for Pluralize and Singularize. Irregulars
+// include words which the suffix rules would get wrong in one direction, like
+// "cache", which would otherwise be singularized as "cach".
+var (
+	irregularPlurals = map[string]string{
+		"alias":       "aliases",
+		"analysis":    "analyses",
+		"atlas":       "atlases",
+		"bias":        "biases",
+		"cache":       "caches",
+		"canvas":      "canvases",
+		"child":       "children",
+		"cookie":      "cookies",
+		"crisis":      "crises",
+		"diagnosis":   "diagnoses",
+		"foot":        "feet",
+		"gas":         "gases",
+		"goose":       "geese",
+		"half":        "halves",
+		"hypothesis":  "hypotheses",
+		"index":       "indices",
+		"knife":       "knives",
+		"leaf":        "leaves",
+		"lens":        "lenses",
+		"life":        "lives",
+		"man":         "men",
+		"matrix":      "matrices",
+		"mouse":       "mice",
+		"movie":       "movies",
+		"ox":          "oxen",
+		"parenthesis": "parentheses",
+		"person":      "people",
+		"quiz":        "quizzes",
+		"self":        "selves",
+		"shelf":       "shelves",
+		"thesis":      "theses",
+		"tooth":       "teeth",
+		"vertex":      "vertices",
+		"whiz":        "whizzes",
+		"wife":        "wives",
+		"wolf":        "wolves",
+		"woman":       "women",
+	}
+	irregularSingulars = invertMap(irregularPlurals)
+	uncountables       = map[string]bool{
+		"data":        true,
+		"equipment":   true,
+		"feedback":    true,
+		"fish":        true,
+		"information": true,
+		"metadata":    true,
+		"money":       true,
+		"news":        true,
+		"series":      true,
+		"sheep":       true,
+		"species":     true,
+	}
+)
+
+func invertMap(m map[string]string) map[string]string {
+	inverted := map[string]string{}
+	for key, value := range m {
+		inverted[value] = key
+	}
+	return inverted
+}
+
+// Pluralize returns the plural of the last word of s, in English, keeping the
+// rest of s as it is, e.g. "UserAccount" becomes "UserAccounts", and
+// "category" becomes "categories".
+func Pluralize(s string) string {
+	return inflectLastWord(s, func(word string) string {
+		if uncountables[word] || irregularSingulars[word] != "" {
+			return word
+		}
+		if plural, isIrregular := irregularPlurals[word]; isIrregular {
+			return plural
+		}
+		switch {
+		case hasAnySuffix(word, "s", "x", "z", "ch", "sh"):
+			return word + "es"
+		case strings.HasSuffix(word, "y") && !endsWithVowelAnd(word, "y"):
+			return strings.TrimSuffix(word, "y") + "ies"
+		}
+		return word + "s"
+	})
+}
+
+// Singularize returns the singular of the last word of s, in English, keeping
+// the rest of s as it is, e.g. "user_accounts" becomes "user_account", and
+// "Categories" becomes "Category". It reverses Pluralize.
+func Singularize(s string) string {
+	return inflectLastWord(s, func(word string) string {
+		if uncountables[word] || irregularPlurals[word] != "" {
+			return word
+		}
+		if singular, isIrregular := irregularSingulars[word]; isIrregular {
+			return singular
+		}
+		switch {
+		case strings.HasSuffix(word, "ies") && len(word) > 4:
+			return strings.TrimSuffix(word, "ies") + "y"
+		case hasAnySuffix(word, "sses", "xes", "ches", "shes"):
+			return strings.TrimSuffix(word, "es")
+		// "waltzes" and "buzzes", but not "sizes".
+		case strings.HasSuffix(word, "zes") && !endsWithVowelAnd(word, "zes"):
+			return strings.TrimSuffix(word, "es")
+		// "statuses" and "buses", but not "houses" or "causes".
+		case strings.HasSuffix(word, "uses") && !endsWithVowelAnd(word, "uses"):
+			return strings.TrimSuffix(word, "es")
+		case strings.HasSuffix(word, "s") && !hasAnySuffix(word, "ss", "us", "is"):
+			return strings.TrimSuffix(word, "s")
+		}
+		return word
+	})
+}
+
+// inflectLastWord replaces the last word of s, as found by Words, with
+// inflect applied to the word in lower case. The case of the result matches
+// the original word: lower, Capitalized or UPPER.
+func inflectLastWord(s string, inflect func(word string) string) string {
+	spans := wordSpans(s)
+	if len(spans) == 0 {
+		return s
+	}
+	last := spans[len(spans)-1]
+	word := s[last[0]:last[1]]
+	inflected := inflect(strings.ToLower(word))
+
+	first, _ := utf8.DecodeRuneInString(word)
+	switch {
+	case len(word) > 1 && strings.ToUpper(word) == word:
+		inflected = strings.ToUpper(inflected)
+	case unicode.IsUpper(first):
+		inflected = capitalize(inflected)
+	}
+	return s[:last[0]] + inflected + s[last[1]:]
+}
+
+func hasAnySuffix(s string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// endsWithVowelAnd reports whether word ends with a vowel followed by suffix,
+// e.g. "key" ends with a vowel and "y", but "city" doesn't.
+func endsWithVowelAnd(word string, suffix string) bool {
+	stem := strings.TrimSuffix(word, suffix)
+	return stem != "" && strings.ContainsRune("aeiou", rune(stem[len(stem)-1]))
+}
+
+// Reserved words of each language, which can't be used as identifiers.
+var (
+	goReservedWords = wordSet(`break case chan const continue default defer else
+		fallthrough for func go goto if import interface map package range return
+		select struct switch type var`)
+	javaReservedWords = wordSet(`abstract assert boolean break byte case catch char
+		class const continue default do double else enum extends false final
+		finally float for goto if implements import instanceof int interface long
+		native new null package private protected public return short static
+		strictfp super switch synchronized this throw throws transient true try
+		void volatile while _`)
+	pythonReservedWords = wordSet(`False None True and as assert async await break
+		class continue def del elif else except finally for from global if import
+		in is lambda nonlocal not or pass raise return try while with yield`)
+)
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// sanitizeIdentifier replaces each character of s which can't appear in an
+// identifier with "_", prefixes "_" if s starts with a digit, and suffixes
+// "_" if s is a reserved word.
+func sanitizeIdentifier(s string, reserved map[string]bool, isIdentifierRune func(r rune) bool) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if isIdentifierRune(r) {
+			return r
+		}
+		return '_'
+	}, s)
+	first, _ := utf8.DecodeRuneInString(sanitized)
+	if sanitized == "" || unicode.IsDigit(first) {
+		sanitized = "_" + sanitized
+	}
+	if reserved[sanitized] {
+		sanitized += "_"
+	}
+	return sanitized
+}
+
+// GoIdentifier makes s a valid Go identifier, e.g. "type" becomes "type_",
+// and "2fa-code" becomes "_2fa_code". It doesn't change the case of s, so
+// combine it with a case function, e.g. GoIdentifier (CamelCase .name).
+func GoIdentifier(s string) string {
+	return sanitizeIdentifier(s, goReservedWords, func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	})
+}
+
+// JavaIdentifier makes s a valid Java identifier. See GoIdentifier.
+func JavaIdentifier(s string) string {
+	return sanitizeIdentifier(s, javaReservedWords, func(r rune) bool {
+		return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	})
+}
+
+// PythonIdentifier makes s a valid Python identifier. See GoIdentifier.
+func PythonIdentifier(s string) string {
+	return sanitizeIdentifier(s, pythonReservedWords, func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,133 @@
+package processor_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestCaseConversions(t *testing.T) {
+	testCases := []struct {
+		input      string
+		camel      string
+		pascal     string
+		snake      string
+		screaming  string
+		kebab      string
+		dot        string
+		title      string
+		inputWords []string
+	}{
+		{"HTTPServer", "httpServer", "HttpServer", "http_server", "HTTP_SERVER", "http-server", "http.server", "HTTP Server", []string{"HTTP", "Server"}},
+		{"http_server", "httpServer", "HttpServer", "http_server", "HTTP_SERVER", "http-server", "http.server", "Http Server", []string{"http", "server"}},
+		{"Big Potato", "bigPotato", "BigPotato", "big_potato", "BIG_POTATO", "big-potato", "big.potato", "Big Potato", []string{"Big", "Potato"}},
+		{"userID", "userId", "UserId", "user_id", "USER_ID", "user-id", "user.id", "User ID", []string{"user", "ID"}},
+		{"userIDs", "userIds", "UserIds", "user_ids", "USER_IDS", "user-ids", "user.ids", "User IDs", []string{"user", "IDs"}},
+		{"APIsList", "apisList", "ApisList", "apis_list", "APIS_LIST", "apis-list", "apis.list", "APIs List", []string{"APIs", "List"}},
+		{"parseHTTPResponse", "parseHttpResponse", "ParseHttpResponse", "parse_http_response", "PARSE_HTTP_RESPONSE", "parse-http-response", "parse.http.response", "Parse HTTP Response", []string{"parse", "HTTP", "Response"}},
+		{"v2Api--config.file", "v2ApiConfigFile", "V2ApiConfigFile", "v2_api_config_file", "V2_API_CONFIG_FILE", "v2-api-config-file", "v2.api.config.file", "V2 Api Config File", []string{"v2", "Api", "config", "file"}},
+		{"MAX_RETRY_COUNT", "maxRetryCount", "MaxRetryCount", "max_retry_count", "MAX_RETRY_COUNT", "max-retry-count", "max.retry.count", "MAX RETRY COUNT", []string{"MAX", "RETRY", "COUNT"}},
+		{"", "", "", "", "", "", "", "", nil},
+	}
+
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.inputWords, processor.Words(testCase.input), testCase.input)
+		require.Equal(t, testCase.camel, processor.CamelCase(testCase.input), testCase.input)
+		require.Equal(t, testCase.pascal, processor.PascalCase(testCase.input), testCase.input)
+		require.Equal(t, testCase.snake, processor.SnakeCase(testCase.input), testCase.input)
+		require.Equal(t, testCase.screaming, processor.ScreamingSnakeCase(testCase.input), testCase.input)
+		require.Equal(t, testCase.kebab, processor.KebabCase(testCase.input), testCase.input)
+		require.Equal(t, testCase.dot, processor.DotCase(testCase.input), testCase.input)
+		require.Equal(t, testCase.title, processor.TitleCase(testCase.input), testCase.input)
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	testCases := []struct {
+		singular string
+		plural   string
+	}{
+		{"user", "users"},
+		{"UserAccount", "UserAccounts"},
+		{"user_account", "user_accounts"},
+		{"category", "categories"},
+		{"Key", "Keys"},
+		{"class", "classes"},
+		{"box", "boxes"},
+		{"batch", "batches"},
+		{"status", "statuses"},
+		{"house", "houses"},
+		{"case", "cases"},
+		{"response", "responses"},
+		{"quiz", "quizzes"},
+		{"waltz", "waltzes"},
+		{"buzz", "buzzes"},
+		{"fizz", "fizzes"},
+		{"jazz", "jazzes"},
+		{"whiz", "whizzes"},
+		{"lens", "lenses"},
+		{"gas", "gases"},
+		{"alias", "aliases"},
+		{"bus", "buses"},
+		{"size", "sizes"},
+		{"archive", "archives"},
+		{"cache", "caches"},
+		{"analysis", "analyses"},
+		{"person", "people"},
+		{"Child", "Children"},
+		{"ADDRESS", "ADDRESSES"},
+		{"metadata", "metadata"},
+	}
+
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.plural, processor.Pluralize(testCase.singular), testCase.singular)
+		require.Equal(t, testCase.singular, processor.Singularize(testCase.plural), testCase.plural)
+		require.Equal(t, testCase.singular, processor.Singularize(testCase.singular), testCase.singular)
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	testCases := []struct {
+		input  string
+		golang string
+		java   string
+		python string
+	}{
+		{"name", "name", "name", "name"},
+		{"type", "type_", "type", "type"},
+		{"class", "class", "class_", "class_"},
+		{"None", "None", "None", "None_"},
+		{"2fa-code", "_2fa_code", "_2fa_code", "_2fa_code"},
+		{"price$", "price_", "price$", "price_"},
+		{"", "_", "__", "_"},
+	}
+
+	for _, testCase := range testCases {
+		require.Equal(t, testCase.golang, processor.GoIdentifier(testCase.input), testCase.input)
+		require.Equal(t, testCase.java, processor.JavaIdentifier(testCase.input), testCase.input)
+		require.Equal(t, testCase.python, processor.PythonIdentifier(testCase.input), testCase.input)
+	}
+}
+
+func TestTemplateFuncsInEveryEngine(t *testing.T) {
+	testCases := []struct {
+		templateMgr func() processor.TemplateMgr
+		tmpl        string
+	}{
+		{processor.GoTemplateMgr, `{{ GoIdentifier (Singularize (CamelCase .name)) }} {{ ScreamingSnakeCase .name }}`},
+		{processor.JetTemplateMgr, `{{ GoIdentifier(Singularize(CamelCase(.name))) }} {{ ScreamingSnakeCase(.name) }}`},
+		{processor.PongoTemplateMgr, `{{ GoIdentifier(Singularize(CamelCase(PARAMS.name))) }} {{ ScreamingSnakeCase(PARAMS.name) }}`},
+		{processor.MustacheTemplateMgr, `{{#GoIdentifier}}{{#Singularize}}{{#CamelCase}}{{ name }}{{/CamelCase}}{{/Singularize}}{{/GoIdentifier}} {{#ScreamingSnakeCase}}{{ name }}{{/ScreamingSnakeCase}}`},
+	}
+
+	for _, testCase := range testCases {
+		templateMgr := testCase.templateMgr()
+		require.NoError(t, templateMgr.ParseOne("test", []byte(testCase.tmpl)))
+		var output bytes.Buffer
+		err := templateMgr.Execute("test", processor.Params{"name": "HTTPServers"}, &output)
+		require.NoError(t, err, testCase.tmpl)
+		require.Equal(t, "httpServer HTTP_SERVERS", output.String(), testCase.tmpl)
+	}
+}
@@ -0,0 +1,237 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParamRef is a reference from a template to a top-level param, e.g.
+// .service_name in a Go template.
+type ParamRef struct {
+	Name string
+	Line int
+	// Uncertain is true for a reference from part of a template which might
+	// not be executed with the params, e.g. a Mustache section or a Go
+	// template define block. It counts as a use of the param, but if there's
+	// no such param, it may refer to something else.
+	Uncertain bool
+}
+
+// ParamRefFinder is implemented by template engines which can find the params
+// a template refers to, without executing it. Each of the built-in engines
+// implements it.
+type ParamRefFinder interface {
+	// FindParamRefs parses the template tmplName, which was passed to
+	// ParseOne, and returns its references to top-level params. A syntax
+	// error in the template, or in a template it includes, is returned as an
+	// error.
+	FindParamRefs(tmplName string) ([]ParamRef, error)
+}
+
+// LintFinding is a problem with a template, found without rendering it. File
+// is a path in the template's filesystem, and Line is 0 if the problem isn't
+// at a particular line.
+type LintFinding struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (f LintFinding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%s: %s", f.File, f.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", f.File, f.Line, f.Message)
+}
+
+// LintTemplates parses the config as a template, along with every file which
+// the DirsMapping of config maps, without executing any of them. The templates
+// are read from templateFS, beneath inputRoot, where configFile is too.
+//
+// It returns a finding for every template which doesn't parse, for every
+// DirsMapping key which isn't a directory, and for every FilesMapping key
+// which isn't the name of a file in any of the mapped directories. It also
+// returns the param references of the config, the templates and any templated
+// file names, keyed by the path of the file. Conditions are ignored, so that
+// every file is checked. Like Render, it uses a new instance of the template
+// engine for each DirsMapping directory, and another for the config.
+func LintTemplates(
+	newTemplateMgr func() TemplateMgr,
+	inputRoot string,
+	configFile string,
+	config Config,
+	templateFS fs.FS,
+) ([]LintFinding, map[string][]ParamRef) {
+	var findings []LintFinding
+	addFinding := func(file string, line int, s string, args ...any) {
+		findings = append(findings, LintFinding{file, line, fmt.Sprintf(s, args...)})
+	}
+	refs := map[string][]ParamRef{}
+
+	// lint parses a template, then finds its param references. line is the
+	// line of the file where the template starts, for templated file names.
+	lint := func(templateMgr TemplateMgr, tmplName string, tmplBody []byte, file string, line int) {
+		err := templateMgr.ParseOne(tmplName, tmplBody)
+		if err != nil {
+			addFinding(file, max(line, ErrorLine(tmplName, err)), "%s", err.Error())
+			return
+		}
+		refFinder, canFindRefs := templateMgr.(ParamRefFinder)
+		if !canFindRefs {
+			return
+		}
+		tmplRefs, err := refFinder.FindParamRefs(tmplName)
+		if err != nil {
+			addFinding(file, max(line, ErrorLine(tmplName, err)), "%s", err.Error())
+			return
+		}
+		for _, ref := range tmplRefs {
+			ref.Line = max(line, ref.Line)
+			refs[file] = append(refs[file], ref)
+		}
+	}
+
+	configPath := path.Join(inputRoot, configFile)
+	configBytes, err := fs.ReadFile(templateFS, configPath)
+	if err != nil {
+		addFinding(configPath, 0, "error reading config: %s", err.Error())
+		return findings, refs
+	}
+	lint(newTemplateMgr(), "__config__", configBytes, configPath, 0)
+
+	// Load every input file before finding param references, so that each
+	// template's partials and base templates are parsed too.
+	type inputFile struct {
+		templateMgr  TemplateMgr
+		templateName string
+		sourcePath   string
+		isTemplate   bool
+	}
+	var inputFiles []inputFile
+	namesByDir := map[string][]string{}
+	for _, inputSubdir := range slices.Sorted(maps.Keys(config.DirsMapping)) {
+		info, err := fs.Stat(templateFS, path.Join(inputRoot, inputSubdir))
+		if err != nil || !info.IsDir() {
+			addFinding(configPath, FindKeyLine(configBytes, inputSubdir),
+				"DirsMapping key %q isn't a directory in %s", inputSubdir, inputRoot)
+			continue
+		}
+
+		templateMgr := newTemplateMgr()
+		templatesLoader := MakeFileLoader(templateFS, inputRoot, inputSubdir)
+		templateNames, err := templatesLoader.FindFiles()
+		if err != nil {
+			addFinding(configPath, 0, "error listing input files in %q: %s", path.Join(inputRoot, inputSubdir), err.Error())
+			continue
+		}
+		namesByDir[inputSubdir] = templateNames
+
+		for _, templateName := range templateNames {
+			sourcePath := path.Join(inputRoot, inputSubdir, templateName)
+			templateContents, err := templatesLoader.LoadFileAsBytes(templateName)
+			if err != nil {
+				addFinding(sourcePath, 0, "error reading template: %s", err.Error())
+				continue
+			}
+			isTemplate := filepath.Ext(templateName) == config.TemplateTypeExt
+			if isTemplate {
+				err = templateMgr.ParseOne(templateName, templateContents)
+				if err != nil {
+					addFinding(sourcePath, ErrorLine(templateName, err), "%s", err.Error())
+					continue
+				}
+			}
+			inputFiles = append(inputFiles, inputFile{templateMgr, templateName, sourcePath, isTemplate})
+		}
+	}
+
+	for _, input := range inputFiles {
+		outputName := input.templateName
+		if input.isTemplate {
+			outputName = strings.TrimSuffix(outputName, config.TemplateTypeExt)
+			refFinder, canFindRefs := input.templateMgr.(ParamRefFinder)
+			if canFindRefs {
+				tmplRefs, err := refFinder.FindParamRefs(input.templateName)
+				if err != nil {
+					addFinding(input.sourcePath, ErrorLine(input.templateName, err), "%s", err.Error())
+				} else if len(tmplRefs) > 0 {
+					refs[input.sourcePath] = append(refs[input.sourcePath], tmplRefs...)
+				}
+			}
+		}
+
+		// File names may refer to params too, as Render resolves them.
+		names := []string{outputName}
+		mappedName, hasFileMapping := config.FilesMapping[outputName]
+		if hasFileMapping {
+			names = append(names, mappedName)
+		}
+		for _, name := range names {
+			if strings.Contains(name, "{{") {
+				lint(input.templateMgr, "__path__/"+name, []byte(name), input.sourcePath, 1)
+			}
+			for _, match := range pathPlaceholder.FindAllStringSubmatch(name, -1) {
+				refs[input.sourcePath] = append(refs[input.sourcePath], ParamRef{match[1], 1, true})
+			}
+		}
+	}
+
+	for _, fileName := range slices.Sorted(maps.Keys(config.FilesMapping)) {
+		found := false
+		for _, templateNames := range namesByDir {
+			if slices.Contains(templateNames, fileName) || slices.Contains(templateNames, fileName+config.TemplateTypeExt) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addFinding(configPath, FindKeyLine(configBytes, fileName),
+				"FilesMapping key %q isn't a file in any of the DirsMapping directories", fileName)
+		}
+	}
+
+	return findings, refs
+}
+
+// FindKeyLine returns the line of the first key named key in a YAML, TOML or
+// HJSON file, or 0 if there isn't one. Keys at any depth are found.
+func FindKeyLine(content []byte, key string) int {
+	quoted := regexp.QuoteMeta(key)
+	keyPattern := regexp.MustCompile(`(?m)^[ \t]*(?:` + quoted + `|"` + quoted + `"|'` + quoted + `')[ \t]*[:=]|^[ \t]*\[` + quoted + `\]`)
+	loc := keyPattern.FindIndex(content)
+	if loc == nil {
+		return 0
+	}
+	return lineAt(content, loc[0])
+}
+
+// lineAt returns the line of the byte at offset in content, counting from 1.
+func lineAt(content []byte, offset int) int {
+	return 1 + strings.Count(string(content[:offset]), "\n")
+}
+
+// ErrorLine returns the line of a template error, for any of the built-in
+// engines, or 0 if the error doesn't say. The engines report lines as
+// "name:3:" (Go and Jet), "in name | Line 3" (Pongo) or "line 3:" (Mustache).
+func ErrorLine(tmplName string, err error) int {
+	quoted := regexp.QuoteMeta(strings.TrimPrefix(tmplName, "/"))
+	linePattern := regexp.MustCompile(quoted + `:(\d+)|in /?` + quoted + ` \| Line (\d+)|^line (\d+):`)
+	match := linePattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	for _, group := range match[1:] {
+		if group != "" {
+			line, _ := strconv.Atoi(group)
+			return line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package processor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestLintTemplates(t *testing.T) {
+	// Each template refers to name, items, other and owner, on lines 1 to 4,
+	// and to a field of each item, which isn't a param. A reference to other
+	// is uncertain where the engine might not execute it with the params.
+	testCases := []struct {
+		ext         string
+		templateMgr func() processor.TemplateMgr
+		body        string
+		brokenBody  string
+		refs        []processor.ParamRef
+	}{
+		{
+			".gotmpl",
+			processor.GoTemplateMgr,
+			"{{ .name }}\n" +
+				"{{ range .items }}{{ .field }}{{ end }}\n" +
+				`{{ define "part" }}{{ .other }}{{ end }}` + "\n" +
+				"{{ with .items }}{{ $.owner }}{{ end }}\n",
+			"ok\n{{ if .name }}",
+			[]processor.ParamRef{{"name", 1, false}, {"items", 2, false}, {"other", 3, true}, {"items", 4, false}, {"owner", 4, false}},
+		},
+		{
+			".jet",
+			processor.JetTemplateMgr,
+			"{{ .name }}\n" +
+				"{{ range .items }}{{ .field }}{{ end }}\n" +
+				"{{ block part() }}{{ .other }}{{ end }}\n" +
+				"{{ range i, item := .items }}{{ .owner }}{{ item.field }}{{ end }}\n",
+			"ok\n{{ if .name }}",
+			[]processor.ParamRef{{"name", 1, false}, {"items", 2, false}, {"other", 3, true}, {"items", 4, false}, {"owner", 4, false}},
+		},
+		{
+			".pongo",
+			processor.PongoTemplateMgr,
+			"{{ PARAMS.name }}\n" +
+				"{% for item in PARAMS.items %}{{ item.field }}{% endfor %}\n" +
+				`{{ PARAMS["other"] }}` + "\n" +
+				"{{ PARAMS.owner|upper }}\n",
+			"ok\n{% if PARAMS.name %}",
+			[]processor.ParamRef{{"name", 1, false}, {"items", 2, false}, {"other", 3, false}, {"owner", 4, false}},
+		},
+		{
+			".mustache",
+			processor.MustacheTemplateMgr,
+			"{{ name }}\n" +
+				"{{#items}}{{ field }}{{/items}}\n" +
+				"{{#items}}{{ other }}{{/items}}{{! a comment }}\n" +
+				"{{#PascalCase}}{{ owner }}{{/PascalCase}}{{=<% %>=}}<%^ owner %>none<%/ owner %>\n",
+			"ok\n{{#name}}",
+			[]processor.ParamRef{{"name", 1, false}, {"items", 2, false}, {"field", 2, true}, {"items", 3, false}, {"other", 3, true}, {"owner", 4, false}, {"owner", 4, false}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ext, func(t *testing.T) {
+			templateFS := processor.NewMemFS()
+			templateFS.WriteFile("config.hjson", []byte(`{
+				DirsMapping: {
+					"templates": "."
+					"missing": "."
+				}
+				FilesMapping: {
+					"main.txt": "__name__.txt"
+					"gone.txt": "x.txt"
+				}
+			}`), 0644)
+			templateFS.WriteFile("templates/main.txt"+tc.ext, []byte(tc.body), 0644)
+			templateFS.WriteFile("templates/broken.txt"+tc.ext, []byte(tc.brokenBody), 0644)
+			templateFS.WriteFile("templates/static.txt", []byte("{{ .ignored }}"), 0644)
+			config := processor.Config{
+				TemplateTypeExt: tc.ext,
+				DirsMapping:     map[string]string{"templates": ".", "missing": "."},
+				FilesMapping:    map[string]string{"main.txt": "__name__.txt", "gone.txt": "x.txt"},
+			}
+
+			findings, refs := processor.LintTemplates(tc.templateMgr, ".", "config.hjson", config, templateFS)
+			require.Equal(t, map[string][]processor.ParamRef{
+				"templates/main.txt" + tc.ext: append(tc.refs, processor.ParamRef{"name", 1, true}),
+			}, refs)
+
+			require.Len(t, findings, 3)
+			require.Equal(t, processor.LintFinding{"config.hjson", 4, `DirsMapping key "missing" isn't a directory in .`}, findings[0])
+			require.Equal(t, "templates/broken.txt"+tc.ext, findings[1].File)
+			require.Equal(t, 2, findings[1].Line)
+			require.Equal(t, processor.LintFinding{"config.hjson", 8, `FilesMapping key "gone.txt" isn't a file in any of the DirsMapping directories`}, findings[2])
+
+			// Each directory's templates are linted separately, even with
+			// the same names.
+			templateFS.WriteFile("a/main.txt"+tc.ext, []byte(tc.brokenBody), 0644)
+			templateFS.WriteFile("b/main.txt"+tc.ext, []byte(tc.body), 0644)
+			config.DirsMapping = map[string]string{"a": "a", "b": "b"}
+			config.FilesMapping = nil
+			findings, refs = processor.LintTemplates(tc.templateMgr, ".", "config.hjson", config, templateFS)
+			require.Equal(t, map[string][]processor.ParamRef{"b/main.txt" + tc.ext: tc.refs}, refs)
+			require.Len(t, findings, 1)
+			require.Equal(t, "a/main.txt"+tc.ext, findings[0].File)
+			require.Equal(t, 2, findings[0].Line)
+		})
+	}
+}
+
+func TestFindKeyLine(t *testing.T) {
+	content := []byte("{\n  name: x\n  \"quoted\": y\n}\n[table]\nkey = 1\n")
+	require.Equal(t, 2, processor.FindKeyLine(content, "name"))
+	require.Equal(t, 3, processor.FindKeyLine(content, "quoted"))
+	require.Equal(t, 5, processor.FindKeyLine(content, "table"))
+	require.Equal(t, 6, processor.FindKeyLine(content, "key"))
+	require.Equal(t, 0, processor.FindKeyLine(content, "missing"))
+}
@@ -1,7 +1,11 @@
 package processor
 
 import (
+	"bytes"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/BurntSushi/toml"
@@ -9,11 +13,13 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-func MakeFileLoader(siteRoot string, relativeDir string, readFileFn func(string) ([]byte, error)) FileLoader {
-	baseDir := filepath.Clean(filepath.Join(siteRoot, relativeDir)) + "/"
+// MakeFileLoader returns a loader for the files beneath siteRoot/relativeDir
+// in fsys. Paths within fsys are slash-separated, as for any fs.FS.
+func MakeFileLoader(fsys fs.FS, siteRoot string, relativeDir string) FileLoader {
+	baseDir := path.Join(siteRoot, relativeDir)
 	return FileLoader{
-		baseDir:    baseDir,
-		readFileFn: readFileFn,
+		fsys:    fsys,
+		baseDir: baseDir,
 		typesMap: map[string]func([]byte, any) error{
 			".yaml": yaml.Unmarshal,
 			".toml": func(fileBytes []byte, output any) error {
@@ -22,14 +28,25 @@ func MakeFileLoader(siteRoot string, relativeDir string, readFileFn func(string)
 			},
 			".hjson": hjson.Unmarshal,
 		},
+		serializersMap: map[string]func(any) ([]byte, error){
+			".yaml": yaml.Marshal,
+			".toml": func(input any) ([]byte, error) {
+				var buf bytes.Buffer
+				err := toml.NewEncoder(&buf).Encode(input)
+				return buf.Bytes(), err
+			},
+			".hjson": hjson.Marshal,
+		},
 	}
 }
 
 type FileLoader struct {
-	baseDir string
-	// e.g. os.ReadFile
-	readFileFn func(string) ([]byte, error)
-	typesMap   map[string]func([]byte, any) error
+	// e.g. os.DirFS
+	fsys     fs.FS
+	baseDir  string
+	typesMap map[string]func([]byte, any) error
+	// The inverse of typesMap, for writing files.
+	serializersMap map[string]func(any) ([]byte, error)
 }
 
 func (l FileLoader) BaseDir() string {
@@ -43,8 +60,17 @@ func (l FileLoader) SupportsFormat(s string) bool {
 }
 
 func (l FileLoader) LoadFileAsBytes(s string) ([]byte, error) {
-	fullPath := filepath.Join(l.baseDir, s)
-	return l.readFileFn(fullPath)
+	fullPath := path.Join(l.baseDir, s)
+	return fs.ReadFile(l.fsys, fullPath)
+}
+
+// FileMode returns the permission bits of the file s.
+func (l FileLoader) FileMode(s string) (os.FileMode, error) {
+	info, err := fs.Stat(l.fsys, path.Join(l.baseDir, s))
+	if err != nil {
+		return 0, err
+	}
+	return info.Mode().Perm(), nil
 }
 
 func (l FileLoader) LoadFile(s string, output any) error {
@@ -67,21 +93,27 @@ func (l FileLoader) DeserializeBytes(s string, contentBytes []byte, output any)
 	return fn(contentBytes, output)
 }
 
-func (l FileLoader) FindFilesWithName(targetName string) []string {
-	matches := FindFilesWithName(l.baseDir, targetName)
-	l.trimPrefixes(matches)
-	return matches
+func (l FileLoader) SerializeBytes(s string, input any) ([]byte, error) {
+	ext := filepath.Ext(s)
+
+	fn, hasFormat := l.serializersMap[ext]
+	if !hasFormat {
+		panic(fmt.Sprintf("Unknown extension on file path %q", s))
+	}
+
+	return fn(input)
 }
 
-func (l FileLoader) FindFiles() []string {
-	matches := FindFiles(l.baseDir)
+func (l FileLoader) FindFilesWithName(targetName string) ([]string, error) {
+	matches, err := FindFilesWithName(l.fsys, l.baseDir, targetName)
 	l.trimPrefixes(matches)
-	return matches
+	return matches, err
 }
 
-func (l FileLoader) Copy(src string, dst string) error {
-	fullPath := filepath.Join(l.baseDir, src)
-	return Copy(fullPath, dst)
+func (l FileLoader) FindFiles() ([]string, error) {
+	matches, err := FindFiles(l.fsys, l.baseDir)
+	l.trimPrefixes(matches)
+	return matches, err
 }
 
 func (l FileLoader) trimPrefixes(matches []string) {
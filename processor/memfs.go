@@ -0,0 +1,268 @@
+package processor
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MemFS is a filesystem held in memory, from which a template can be read.
+// Files are added with WriteFile, and directories are created implicitly for
+// every file. Like any fs.FS, names are unrooted and slash-separated.
+type MemFS struct {
+	files map[string]*memFile
+	dirs  map[string]bool
+}
+
+type memFile struct {
+	data []byte
+	mode fs.FileMode
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: map[string]*memFile{},
+		dirs:  map[string]bool{".": true},
+	}
+}
+
+func (m *MemFS) addParentDirs(name string) {
+	for dir := path.Dir(name); !m.dirs[dir]; dir = path.Dir(dir) {
+		m.dirs[dir] = true
+	}
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, isFile := m.files[name]; isFile {
+		return &memOpenFile{memFileInfo{path.Base(name), f}, bytes.NewReader(f.data)}, nil
+	}
+	if m.dirs[name] {
+		entries, _ := m.ReadDir(name)
+		return &memOpenDir{memFileInfo{path.Base(name), nil}, entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := m.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.Stat()
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !m.dirs[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for dir := range m.dirs {
+		if dir != "." && path.Dir(dir) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{path.Base(dir), nil}))
+		}
+	}
+	for file := range m.files {
+		if path.Dir(file) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{path.Base(file), m.files[file]}))
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, isFile := m.files[name]
+	if !isFile {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(f.data), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if m.dirs[name] {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+	m.addParentDirs(name)
+
+	f, isFile := m.files[name]
+	if !isFile {
+		f = &memFile{mode: perm.Perm()}
+		m.files[name] = f
+	}
+	f.data = bytes.Clone(data)
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, isFile := m.files[name]; isFile {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	m.addParentDirs(name)
+	m.dirs[name] = true
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode fs.FileMode) error {
+	f, isFile := m.files[name]
+	if !isFile {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	f.mode = mode.Perm()
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	if _, isFile := m.files[name]; isFile {
+		delete(m.files, name)
+		return nil
+	}
+	if !m.dirs[name] || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, _ := m.ReadDir(name)
+	if len(entries) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+	}
+	delete(m.dirs, name)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	isBeneath := func(p string) bool {
+		return name == "." || p == name || strings.HasPrefix(p, name+"/")
+	}
+	maps.DeleteFunc(m.files, func(p string, _ *memFile) bool {
+		return isBeneath(p)
+	})
+	maps.DeleteFunc(m.dirs, func(p string, _ bool) bool {
+		return p != "." && isBeneath(p)
+	})
+	return nil
+}
+
+// Rename moves a file or a directory, like os.Rename. A file replaces any file
+// at newName, but a directory can't replace anything.
+func (m *MemFS) Rename(oldName string, newName string) error {
+	if !fs.ValidPath(oldName) || !fs.ValidPath(newName) || oldName == "." || newName == "." {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	if f, isFile := m.files[oldName]; isFile {
+		if m.dirs[newName] {
+			return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrExist}
+		}
+		m.addParentDirs(newName)
+		delete(m.files, oldName)
+		m.files[newName] = f
+		return nil
+	}
+	if !m.dirs[oldName] {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	_, isFile := m.files[newName]
+	if isFile || m.dirs[newName] || strings.HasPrefix(newName, oldName+"/") {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrExist}
+	}
+
+	moved := func(p string) (string, bool) {
+		if p == oldName {
+			return newName, true
+		}
+		rest, isBeneath := strings.CutPrefix(p, oldName+"/")
+		return newName + "/" + rest, isBeneath
+	}
+	for _, p := range slices.Collect(maps.Keys(m.files)) {
+		if newPath, isMoved := moved(p); isMoved {
+			m.files[newPath] = m.files[p]
+			delete(m.files, p)
+		}
+	}
+	for _, p := range slices.Collect(maps.Keys(m.dirs)) {
+		if newPath, isMoved := moved(p); isMoved {
+			m.dirs[newPath] = true
+			delete(m.dirs, p)
+		}
+	}
+	m.addParentDirs(newName)
+	return nil
+}
+
+// memFileInfo describes a file, or a directory if file is nil.
+type memFileInfo struct {
+	name string
+	file *memFile
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi memFileInfo) IsDir() bool        { return fi.file == nil }
+func (fi memFileInfo) Sys() any           { return nil }
+
+func (fi memFileInfo) Size() int64 {
+	if fi.file == nil {
+		return 0
+	}
+	return int64(len(fi.file.data))
+}
+
+func (fi memFileInfo) Mode() fs.FileMode {
+	if fi.file == nil {
+		return fs.ModeDir | 0755
+	}
+	return fi.file.mode
+}
+
+type memOpenFile struct {
+	info memFileInfo
+	r    *bytes.Reader
+}
+
+func (f *memOpenFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memOpenFile) Read(b []byte) (int, error) { return f.r.Read(b) }
+func (f *memOpenFile) Close() error               { return nil }
+
+type memOpenDir struct {
+	info    memFileInfo
+	entries []fs.DirEntry
+}
+
+func (d *memOpenDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memOpenDir) Close() error               { return nil }
+
+func (d *memOpenDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *memOpenDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
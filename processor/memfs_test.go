@@ -0,0 +1,51 @@
+package processor_test
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestMemFS(t *testing.T) {
+	m := processor.NewMemFS()
+	require.NoError(t, m.WriteFile("templates/a.txt", []byte("a"), 0644))
+	require.NoError(t, m.WriteFile("templates/sub/b.sh", []byte("b"), 0755))
+	require.NoError(t, m.MkdirAll("templates/empty", 0755))
+	require.Error(t, m.WriteFile("/templates/c.txt", []byte("c"), 0644))
+
+	require.NoError(t, fstest.TestFS(m, "templates/a.txt", "templates/sub/b.sh", "templates/empty"))
+
+	info, err := fs.Stat(m, "templates/sub/b.sh")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode())
+}
+
+func TestMemOutputFS(t *testing.T) {
+	m := processor.NewMemOutputFS()
+	require.NoError(t, m.MkdirAll("/output/sub", 0755))
+	require.NoError(t, m.WriteFile("/output/a.txt", []byte("a"), 0644))
+	require.NoError(t, m.WriteFile("output/sub/b.sh", []byte("b"), 0644))
+
+	contents, err := m.ReadFile("output/a.txt")
+	require.NoError(t, err)
+	require.Equal(t, "a", string(contents))
+
+	require.NoError(t, m.Chmod("/output/sub/b.sh", 0755))
+	info, err := fs.Stat(m.Files, "output/sub/b.sh")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode())
+
+	require.Error(t, m.Remove("/output/sub"))
+	require.NoError(t, m.Remove("/output/sub/b.sh"))
+	require.NoError(t, m.Remove("/output/sub"))
+	require.True(t, os.IsNotExist(m.Remove("/output/sub")))
+
+	require.NoError(t, m.RemoveAll("/output"))
+	_, err = m.ReadFile("/output/a.txt")
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, fstest.TestFS(m.Files))
+}
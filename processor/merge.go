@@ -0,0 +1,136 @@
+package processor
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	conflictStartMarker = "<<<<<<< current\n"
+	conflictMidMarker   = "=======\n"
+	conflictEndMarker   = ">>>>>>> generated\n"
+)
+
+// Merge3 performs a line-based three-way merge. base is the output of a
+// previous sprout run, current is that output as since modified by the user,
+// and generated is the output of the new sprout run. Changes made on only
+// one side are applied. Where the user and the template changed the same
+// lines differently, both versions are kept between conflict markers. Merge3
+// returns the merged content and the number of conflicts.
+func Merge3(base []byte, current []byte, generated []byte) ([]byte, int) {
+	baseLines := splitLines(base)
+	currentLines := splitLines(current)
+	generatedLines := splitLines(generated)
+
+	currentMatches := matchLines(baseLines, currentLines)
+	generatedMatches := matchLines(baseLines, generatedLines)
+
+	var merged bytes.Buffer
+	conflicts := 0
+
+	// i, j and k are the positions in base, current and generated. Walk
+	// forward alternating between stable chunks, where all three agree, and
+	// unstable chunks, where at least one side differs from base.
+	i, j, k := 0, 0, 0
+	for {
+		n := 0
+		for i+n < len(baseLines) && currentMatches[i+n] == j+n && generatedMatches[i+n] == k+n {
+			n++
+		}
+		if n > 0 {
+			writeLines(&merged, baseLines[i:i+n])
+			i, j, k = i+n, j+n, k+n
+			continue
+		}
+
+		// Find the next base line which survives on both sides. Everything
+		// before it is an unstable chunk.
+		m := i
+		for m < len(baseLines) && (currentMatches[m] < j || generatedMatches[m] < k) {
+			m++
+		}
+		nextJ, nextK := len(currentLines), len(generatedLines)
+		if m < len(baseLines) {
+			nextJ, nextK = currentMatches[m], generatedMatches[m]
+		}
+
+		baseChunk := baseLines[i:m]
+		currentChunk := currentLines[j:nextJ]
+		generatedChunk := generatedLines[k:nextK]
+		switch {
+		case equalLines(currentChunk, baseChunk):
+			writeLines(&merged, generatedChunk)
+		case equalLines(generatedChunk, baseChunk), equalLines(currentChunk, generatedChunk):
+			writeLines(&merged, currentChunk)
+		default:
+			conflicts++
+			merged.WriteString(conflictStartMarker)
+			writeLines(&merged, currentChunk)
+			ensureNewline(&merged)
+			merged.WriteString(conflictMidMarker)
+			writeLines(&merged, generatedChunk)
+			ensureNewline(&merged)
+			merged.WriteString(conflictEndMarker)
+		}
+
+		if m == len(baseLines) {
+			break
+		}
+		i, j, k = m, nextJ, nextK
+	}
+
+	return merged.Bytes(), conflicts
+}
+
+// matchLines returns, for each line of base, the index of the matching line
+// in other, or -1 if the line was changed or removed.
+func matchLines(base []string, other []string) []int {
+	matches := make([]int, len(base))
+	for i := range matches {
+		matches[i] = -1
+	}
+
+	matcher := difflib.NewMatcherWithJunk(base, other, false, nil)
+	for _, block := range matcher.GetMatchingBlocks() {
+		for n := 0; n < block.Size; n++ {
+			matches[block.A+n] = block.B + n
+		}
+	}
+	return matches
+}
+
+// splitLines splits content into lines, keeping each line's terminating
+// newline, so that the content can be reassembled exactly.
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(buf *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		buf.WriteString(line)
+	}
+}
+
+func ensureNewline(buf *bytes.Buffer) {
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
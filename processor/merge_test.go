@@ -0,0 +1,94 @@
+package processor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestMerge3(t *testing.T) {
+	testCases := []struct {
+		name              string
+		base              string
+		current           string
+		generated         string
+		expectedOutput    string
+		expectedConflicts int
+	}{
+		{
+			"unchanged",
+			"a\nb\nc\n",
+			"a\nb\nc\n",
+			"a\nb\nc\n",
+			"a\nb\nc\n",
+			0,
+		},
+		{
+			"only template changed",
+			"a\nb\nc\n",
+			"a\nb\nc\n",
+			"a\nB\nc\nd\n",
+			"a\nB\nc\nd\n",
+			0,
+		},
+		{
+			"only user changed",
+			"a\nb\nc\n",
+			"a\nb\nuser\nc\n",
+			"a\nb\nc\n",
+			"a\nb\nuser\nc\n",
+			0,
+		},
+		{
+			"both changed different lines",
+			"a\nb\nc\nd\ne\n",
+			"A\nb\nc\nd\ne\n",
+			"a\nb\nc\nd\nE\n",
+			"A\nb\nc\nd\nE\n",
+			0,
+		},
+		{
+			"both made the same change",
+			"a\nb\nc\n",
+			"a\nB\nc\n",
+			"a\nB\nc\n",
+			"a\nB\nc\n",
+			0,
+		},
+		{
+			"both changed the same line",
+			"a\nb\nc\n",
+			"a\nuser\nc\n",
+			"a\ntemplate\nc\n",
+			"a\n<<<<<<< current\nuser\n=======\ntemplate\n>>>>>>> generated\nc\n",
+			1,
+		},
+		{
+			"no base and no trailing newline",
+			"",
+			"user",
+			"template",
+			"<<<<<<< current\nuser\n=======\ntemplate\n>>>>>>> generated\n",
+			1,
+		},
+		{
+			"user deleted a line the template kept",
+			"a\nb\nc\n",
+			"a\nc\n",
+			"a\nb\nc\nd\n",
+			"a\nc\nd\n",
+			0,
+		},
+	}
+
+	for _, testCase := range testCases {
+		output, conflicts := processor.Merge3(
+			[]byte(testCase.base),
+			[]byte(testCase.current),
+			[]byte(testCase.generated),
+		)
+		require.Equal(t, testCase.expectedOutput, string(output), testCase.name)
+		require.Equal(t, testCase.expectedConflicts, conflicts, testCase.name)
+	}
+}
@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// parseFileModes converts the values of Config.FileModes from octal strings,
+// like "0755", to file modes.
+func parseFileModes(fileModes map[string]string) (map[string]os.FileMode, []error) {
+	var errs []error
+	parsed := map[string]os.FileMode{}
+	for pattern, value := range fileModes {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || mode > 0777 {
+			errs = append(errs, fmt.Errorf("file mode for %q must be an octal permission like \"0755\", got %q", pattern, value))
+			continue
+		}
+		parsed[pattern] = os.FileMode(mode)
+	}
+	return parsed, errs
+}
+
+// overrideFileMode returns the mode from fileModes for the output file name,
+// if any pattern matches it, and otherwise returns defaultMode. If several
+// patterns match, the longest, i.e. most specific, one wins.
+func overrideFileMode(fileModes map[string]os.FileMode, name string, defaultMode os.FileMode) os.FileMode {
+	mode := defaultMode
+	bestPattern := ""
+	for _, pattern := range slices.Sorted(maps.Keys(fileModes)) {
+		if MatchGlob(pattern, name) && len(pattern) > len(bestPattern) {
+			mode = fileModes[pattern]
+			bestPattern = pattern
+		}
+	}
+	return mode
+}
@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// OutputFS is the filesystem that sprout writes its output to. Paths are
+// passed as they're built from the --output directory, in the OS's format.
+type OutputFS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Chmod(name string, mode fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldName string, newName string) error
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// DiskFS is the OutputFS of the local filesystem.
+type DiskFS struct{}
+
+func (DiskFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (DiskFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (DiskFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (DiskFS) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (DiskFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (DiskFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (DiskFS) Rename(oldName string, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (DiskFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// MemOutputFS is an OutputFS which captures output in memory, in Files, e.g.
+// for tests or previews. Paths are converted to names in Files by dropping
+// any leading "/", so "/output/a.txt" and "output/a.txt" name the same file.
+type MemOutputFS struct {
+	Files *MemFS
+}
+
+func NewMemOutputFS() MemOutputFS {
+	return MemOutputFS{NewMemFS()}
+}
+
+// memName converts an OutputFS path to the name of a file in a MemFS.
+func memName(name string) string {
+	name = strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (m MemOutputFS) ReadFile(name string) ([]byte, error) {
+	return m.Files.ReadFile(memName(name))
+}
+
+func (m MemOutputFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return m.Files.WriteFile(memName(name), data, perm)
+}
+
+func (m MemOutputFS) MkdirAll(name string, perm fs.FileMode) error {
+	return m.Files.MkdirAll(memName(name), perm)
+}
+
+func (m MemOutputFS) Chmod(name string, mode fs.FileMode) error {
+	return m.Files.Chmod(memName(name), mode)
+}
+
+func (m MemOutputFS) Remove(name string) error {
+	return m.Files.Remove(memName(name))
+}
+
+func (m MemOutputFS) RemoveAll(name string) error {
+	return m.Files.RemoveAll(memName(name))
+}
+
+func (m MemOutputFS) Rename(oldName string, newName string) error {
+	return m.Files.Rename(memName(oldName), memName(newName))
+}
+
+func (m MemOutputFS) Stat(name string) (fs.FileInfo, error) {
+	return m.Files.Stat(memName(name))
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A __param__ placeholder in a path is replaced by the value of the
+// top-level param with that name. Placeholders which don't name a param,
+// like Python's __init__.py, are left alone.
+var pathPlaceholder = regexp.MustCompile(`__([A-Za-z][A-Za-z0-9_]*?)__`)
+
+// renderPath resolves the templated parts of an output path, relative to its
+// output directory. A path may contain template expressions, which are
+// executed with the same engine and params as the file contents (e.g.
+// "cmd/{{ .service_name }}/main.go"), or __param__ placeholders (e.g.
+// "cmd/__service_name__/main.go").
+func renderPath(templateMgr TemplateMgr, name string, params Params) (string, error) {
+	rendered := name
+	if strings.Contains(name, "{{") {
+		tmplName := "__path__/" + name
+		err := templateMgr.ParseOne(tmplName, []byte(name))
+		if err != nil {
+			return "", fmt.Errorf("error parsing templated path %q: %s", name, err.Error())
+		}
+
+		var output bytes.Buffer
+		err = templateMgr.Execute(tmplName, params, &output)
+		if err != nil {
+			return "", fmt.Errorf("error executing templated path %q: %s", name, err.Error())
+		}
+		rendered = output.String()
+	}
+
+	rendered = pathPlaceholder.ReplaceAllStringFunc(rendered, func(placeholder string) string {
+		paramName := pathPlaceholder.FindStringSubmatch(placeholder)[1]
+		value, hasParam := params[paramName]
+		if !hasParam {
+			return placeholder
+		}
+		return fmt.Sprint(value)
+	})
+
+	if rendered == name {
+		return name, nil
+	}
+
+	cleaned := filepath.Clean(rendered)
+	if strings.TrimSpace(rendered) == "" || filepath.IsAbs(cleaned) ||
+		cleaned == ".." || strings.HasPrefix(cleaned, "../") ||
+		strings.Contains(rendered, "//") || strings.HasSuffix(rendered, "/") {
+		return "", fmt.Errorf("templated path %q resolved to invalid path %q", name, rendered)
+	}
+	return cleaned, nil
+}
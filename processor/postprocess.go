@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// postProcessorEnv returns the variables sprout adds to the environment of the
+// post-processor:
+//   - SPROUT_OUTPUT_ROOT, the absolute path of the output directory
+//   - SPROUT_PARAMS_FILE, the path of a JSON file holding the params
+//   - SPROUT_PARAM_<NAME> for each param. See flattenParams.
+func postProcessorEnv(absOutputRoot string, paramsFile string, params Params) []string {
+	var env []string
+	env = append(env, "SPROUT_OUTPUT_ROOT="+absOutputRoot)
+	env = append(env, "SPROUT_PARAMS_FILE="+paramsFile)
+	flattenParams("SPROUT_PARAM", map[string]any(params), &env)
+	return env
+}
+
+// flattenParams appends an environment variable for each value in params to
+// env. The name of each variable is the path to the value, upper-cased and
+// joined by "_", with any characters which aren't letters, digits or "_"
+// replaced by "_". For example, {"db": {"max-conns": 10}} becomes
+// SPROUT_PARAM_DB_MAX_CONNS=10. Lists are encoded as JSON.
+func flattenParams(prefix string, value any, env *[]string) {
+	switch typed := value.(type) {
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(typed)) {
+			flattenParams(prefix+"_"+envName(key), typed[key], env)
+		}
+	case []any:
+		listBytes, err := json.Marshal(typed)
+		if err != nil {
+			listBytes = []byte(fmt.Sprint(typed))
+		}
+		*env = append(*env, prefix+"="+string(listBytes))
+	case nil:
+		*env = append(*env, prefix+"=")
+	default:
+		*env = append(*env, fmt.Sprintf("%s=%v", prefix, typed))
+	}
+}
+
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, key)
+}
+
+// writeParamsFile writes the params as JSON to a new temporary file, and
+// returns its path. The caller must remove it.
+func writeParamsFile(params Params) (string, error) {
+	paramsBytes, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	paramsFile, err := os.CreateTemp("", "sprout-params-*.json")
+	if err != nil {
+		return "", err
+	}
+	_, err = paramsFile.Write(paramsBytes)
+	closeErr := paramsFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(paramsFile.Name())
+		return "", err
+	}
+	return paramsFile.Name(), nil
+}
+
+// logWriter is an io.Writer which passes each complete line written to it to
+// logf, as it arrives, and keeps a copy of everything written in Output. Call
+// Flush at the end, to pass on any final line without a trailing newline.
+type logWriter struct {
+	logf    Logf
+	prefix  string
+	partial []byte
+	Output  []byte
+}
+
+func newLogWriter(logf Logf, prefix string) *logWriter {
+	return &logWriter{logf: logf, prefix: prefix}
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.Output = append(w.Output, p...)
+	w.partial = append(w.partial, p...)
+	for {
+		line, rest, found := bytes.Cut(w.partial, []byte("\n"))
+		if !found {
+			break
+		}
+		w.logf("%s%s", w.prefix, line)
+		w.partial = rest
+	}
+	return len(p), nil
+}
+
+func (w *logWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.logf("%s%s", w.prefix, w.partial)
+		w.partial = nil
+	}
+}
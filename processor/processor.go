@@ -2,25 +2,36 @@ package processor
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"maps"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 )
 
 // Config is a static definition defining the template behavior. It itself
-// can be templated, except for the TemplateTypeExt field. All other fields
-// will be used only after any template expressions are resolved.
+// can be templated, except for the TemplateTypeExt, ParamsSchema, Extends and
+// Layers fields. All other fields will be used only after any template
+// expressions are resolved.
 type Config struct {
 	TemplateTypeExt     string
 	TemplateParamsFile  string
+	Extends             string
+	Layers              []string
 	DirsMapping         map[string]string
 	FilesMapping        map[string]string
 	PostProcessorScript string
+	Commands            []string
+	ParamsSchema        ParamsSchema
+	Conditions          map[string]string
+	FileModes           map[string]string
+	Hooks               Hooks
 }
 
 // Params is the user-specified input to the template. These params are combined
@@ -32,174 +43,317 @@ type Params map[string]any
 
 // TemplateMgr represents a templating engine. A new template system
 // (e.g. Mustache) can be dropped in easily if it satisfies, or can be wrapped
-// in, this interface.
+// in, this interface. Execute must be safe to call from several goroutines at
+// once, since Render executes templates in parallel.
 type TemplateMgr interface {
 	ParseOne(tmplName string, tmplBody []byte) error
 	Execute(tmplName string, tmplData any, output io.Writer) error
 }
 
-func Process(
-	templateMgr TemplateMgr,
-	inputRoot string,
+// OutputFile is the rendered content of a single output file, and where it
+// came from. Template is the path of the source file relative to the input
+// root, and MappedDir is the DirsMapping target it was written beneath.
+// RemappedFrom is the name, relative to MappedDir, which the file would have
+// had if FilesMapping or a templated file name hadn't renamed it, or "" if
+// the file wasn't renamed.
+type OutputFile struct {
+	Content      []byte
+	Template     string
+	MappedDir    string
+	Mode         os.FileMode
+	RemappedFrom string
+}
+
+// TemplateError is an error in a template file, like a syntax error or a
+// failure to execute it. File is the path of the template relative to the
+// input root, and Line is 0 if the template engine didn't say which line.
+type TemplateError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// StageResult describes what StageOutput did. Paths are relative to the
+// output root. Skipped files were modified by the user, and left in place.
+// Conflicted files were written with merge conflicts, and are also in Written.
+type StageResult struct {
+	Written    []string
+	Skipped    []string
+	Conflicted []string
+	Digest     Digest
+}
+
+// StageOutput writes rendered output files, the digest and the base render.
+// Every file is attempted, and every error returned, so outputFS should be a
+// Transaction, to be committed only if there are no errors. Files merged with
+// conflicts aren't errors here, since they must be committed for the user to
+// resolve. See MergeConflictsError.
+//
+// skipFiles are the previous digest's entries for files to leave in place,
+// e.g. because the user modified them, keyed by path relative to outputRoot.
+// They're carried forward into the new digest, even if the template no longer
+// renders them, so they remain protected in later runs.
+func StageOutput(
+	outputContents map[string]OutputFile,
 	outputRoot string,
+	templateSource TemplateSource,
 	absDigestPath string,
-	autoRunPostProcessor bool,
-	config Config,
+	update bool,
+	skipFiles map[string]DigestFile,
 	params Params,
-	readFileFn func(string) ([]byte, error),
-	writeFileFn func(string, []byte, os.FileMode) error,
-) []error {
+	outputFS OutputFS,
+	logf Logf,
+) (StageResult, []error) {
+	var result StageResult
 	var errs []error
 	addError := func(s string, args ...any) {
 		errs = append(errs, fmt.Errorf(s, args...))
 	}
 
-	outputContents := map[string][]byte{}
-	for inputSubdir, targetSubdir := range config.DirsMapping {
-		templatesLoader := MakeFileLoader(
-			filepath.Join(inputRoot, inputSubdir),
-			".",
-			readFileFn,
-		)
+	// Write the output to a corresponding file in the output directory.
+	baseRenderDir := BaseRenderDir(absDigestPath)
+	filesWritten := make([]DigestFile, 0, len(outputContents))
+	renderedPaths := map[string]bool{}
+	baseContents := map[string][]byte{}
+	allPaths := slices.Sorted(maps.Keys(outputContents))
+	for _, path := range allPaths {
+		outputFile := outputContents[path]
+		content := outputFile.Content
 
-		// Find all files in the input directory.
-		templateNames := templatesLoader.FindFiles()
-		if len(templateNames) == 0 {
-			addError("no input files found in %q", inputRoot)
-			return errs
+		// Record the hash of the generated content, not of any merged
+		// content, so that a file with merged edits is recognized as
+		// modified by the user. Files skipped because the user modified them
+		// stay in the digest, so they remain protected in later runs.
+		digestFile := DigestFile{
+			Path:      SafeCutPrefix(path, outputRoot),
+			SHA256:    HashBytes(outputFile.Content),
+			Template:  outputFile.Template,
+			MappedDir: outputFile.MappedDir,
+			Mode:      outputFile.Mode,
+		}
+		renderedPaths[digestFile.Path] = true
+		if _, isSkipped := skipFiles[digestFile.Path]; isSkipped {
+			logf("    Skipping user-modified file %s", path)
+			filesWritten = append(filesWritten, digestFile)
+			result.Skipped = append(result.Skipped, digestFile.Path)
+			continue
 		}
 
-		// Process each template found, generating a corresponding output file in
-		// the output directory.
-		for _, templateName := range templateNames {
-			fileExt := filepath.Ext(templateName)
-			templateContents, err := templatesLoader.LoadFileAsBytes(templateName)
-			if err != nil {
-				addError("error reading template %q: %s", templateName, err.Error())
-				continue
-			}
-
-			var output bytes.Buffer
-			if fileExt != config.TemplateTypeExt {
-				// If the file extension isn't recognized as a template file type,
-				// assume it's a non-templated file and just copy it over directly.
-				_, err = output.Write(templateContents)
-				if err != nil {
-					addError("error copying file contents of %s into buffer: %s", templateName, err.Error())
-					continue
-				}
-			} else {
-				err = templateMgr.ParseOne(templateName, templateContents)
-				if err != nil {
-					addError("error parsing template %q: %s", templateName, err.Error())
-					continue
-				}
-
-				err = templateMgr.Execute(templateName, params, &output)
-				if err != nil {
-					addError("error executing template: %s", err.Error())
-					continue
-				}
-				templateName = strings.TrimSuffix(templateName, config.TemplateTypeExt)
-			}
+		outputFileDir := filepath.Dir(path)
+		err := outputFS.MkdirAll(outputFileDir, 0755)
+		if err != nil {
+			addError("error creating output directory %s: %s", outputFileDir, err.Error())
+			continue
+		}
 
-			// Prepare output content, but don't write it yet, until we're
-			// confident there are no processing errors in any templates.
-			outputSubdirPath := filepath.Join(outputRoot, targetSubdir)
-			realTemplateName, hasFileMapping := config.FilesMapping[templateName]
-			if !hasFileMapping {
-				// This is the common case. Most file names *won't* need to be
-				// rewritten with params-aware name components.
-				realTemplateName = templateName
-			} else {
-				Printfln("Remap filename %q -> %q", templateName, realTemplateName)
-			}
-			outputPath := filepath.Join(outputSubdirPath, realTemplateName)
-			_, hasPath := outputContents[outputPath]
-			if hasPath {
-				addError("at least two template files map to the same output location: %s", outputPath)
+		if update {
+			var conflicts int
+			content, conflicts, err = mergeWithCurrent(outputRoot, baseRenderDir, path, content, outputFS.ReadFile)
+			if err != nil {
+				addError("error merging output file %s: %s", path, err.Error())
 				continue
 			}
-
-			outputBytes := bytes.TrimSpace(output.Bytes())
-			if len(outputBytes) == 0 {
-				Printfln("skipping output file with no output: %s", outputPath)
-				continue
+			if conflicts > 0 {
+				logf("    Merged file %s with %d conflicts", path, conflicts)
+				result.Conflicted = append(result.Conflicted, digestFile.Path)
 			}
-			outputContents[outputPath] = output.Bytes()
 		}
-	}
 
-	// Short-circuit before doing any writes, if errors occurred.
-	if len(errs) > 0 {
-		return errs
-	}
-
-	// Write the output to a corresponding file in the output directory.
-	filesWritten := make([]string, 0, len(outputContents))
-	allPaths := slices.Sorted(maps.Keys(outputContents))
-	for _, path := range allPaths {
-		content := outputContents[path]
-		outputFileDir := filepath.Dir(path)
-		err := os.MkdirAll(outputFileDir, 0755)
+		logf("    Writing file %s", path)
+		err = outputFS.WriteFile(path, content, outputFile.Mode)
 		if err != nil {
-			addError("error creating output directory %s: %s", outputFileDir, err.Error())
+			addError("error writing output file: %s", err.Error())
 			continue
 		}
 
-		Printfln("    Writing file %s", path)
-		err = os.WriteFile(path, content, 0644)
+		// WriteFile only applies the mode to new files, and is subject to
+		// the umask. Set it explicitly.
+		err = outputFS.Chmod(path, outputFile.Mode)
 		if err != nil {
-			addError("error writing output file: %s", err.Error())
+			addError("error setting mode of output file: %s", err.Error())
 			continue
 		}
+		filesWritten = append(filesWritten, digestFile)
+		result.Written = append(result.Written, digestFile.Path)
+		baseContents[digestFile.Path] = outputFile.Content
+	}
 
-		path = SafeCutPrefix(path, outputRoot)
-		filesWritten = append(filesWritten, path)
+	// Skipped files which weren't rendered this time keep their previous
+	// digest entries, hashes and all, so that they're still recognized as
+	// modified, or else cleaned up once the user reverts them.
+	for _, relPath := range slices.Sorted(maps.Keys(skipFiles)) {
+		if renderedPaths[relPath] {
+			continue
+		}
+		logf("    Keeping user-modified file %s", filepath.Join(outputRoot, relPath))
+		filesWritten = append(filesWritten, skipFiles[relPath])
+		result.Skipped = append(result.Skipped, relPath)
 	}
+	slices.SortFunc(filesWritten, func(a, b DigestFile) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	slices.Sort(result.Skipped)
 
 	// Write the digest file.
-	digestContents := strings.Join(filesWritten, "\n")
-	err := os.WriteFile(absDigestPath, []byte(digestContents), 0644)
+	paramsHash, err := HashParams(params)
+	if err != nil {
+		addError("error hashing params for digest: %s", err.Error())
+	}
+	digest := Digest{
+		SproutVersion:  SproutVersion(),
+		TemplateConfig: templateSource.Config,
+		TemplateCommit: templateSource.Commit,
+		ParamsHash:     paramsHash,
+		Files:          filesWritten,
+	}
+	result.Digest = digest
+	digestContents, err := digest.Marshal()
+	if err == nil {
+		err = outputFS.WriteFile(absDigestPath, digestContents, 0644)
+	}
 	if err != nil {
 		addError("error writing digest file: %s", err.Error())
 	}
 
-	// Run the post-processing script, if any.
-	for config.PostProcessorScript != "" {
-		fullRelativePath := filepath.Join(outputRoot, config.PostProcessorScript)
+	// Keep a pristine copy of the output, to serve as the common ancestor
+	// when a later update merges the user's edits with new output. Skipped
+	// files weren't written, so they keep their previous base, if any.
+	for relPath := range skipFiles {
+		content, err := outputFS.ReadFile(filepath.Join(baseRenderDir, relPath))
+		if err == nil {
+			baseContents[relPath] = content
+		}
+	}
+	err = outputFS.RemoveAll(baseRenderDir)
+	if err != nil {
+		addError("error removing previous base render: %s", err.Error())
+	}
+	for _, relPath := range slices.Sorted(maps.Keys(baseContents)) {
+		basePath := filepath.Join(baseRenderDir, relPath)
+		err := outputFS.MkdirAll(filepath.Dir(basePath), 0755)
+		if err == nil {
+			err = outputFS.WriteFile(basePath, baseContents[relPath], 0644)
+		}
+		if err != nil {
+			addError("error writing base render file: %s", err.Error())
+		}
+	}
+
+	return result, errs
+}
+
+// MergeConflictsError returns an error naming the files written with merge
+// conflicts, or nil if there are none. Paths are relative to outputRoot.
+func MergeConflictsError(outputRoot string, conflicted []string) error {
+	if len(conflicted) == 0 {
+		return nil
+	}
+	conflictedPaths := make([]string, len(conflicted))
+	for i, path := range conflicted {
+		conflictedPaths[i] = filepath.Join(outputRoot, path)
+	}
+	return fmt.Errorf("merge conflicts must be resolved by hand in: %s", strings.Join(conflictedPaths, ", "))
+}
 
-		err = os.Chdir(outputRoot)
+// RunPostProcessors runs the post-processor scripts, in order, in the output
+// directory, once the output is written. An error stops the remaining
+// scripts. The scripts' output is passed to logf as it arrives, and returned.
+// Each script is restricted by sandbox, if it's not nil. If
+// autoRunPostProcessor is false, the scripts are only made executable, for
+// the user to run by hand.
+func RunPostProcessors(
+	outputRoot string,
+	autoRunPostProcessor bool,
+	postProcessorScripts []string,
+	sandbox *Sandbox,
+	params Params,
+	outputFS OutputFS,
+	logf Logf,
+) ([]byte, []error) {
+	var output []byte
+	var errs []error
+	addError := func(s string, args ...any) {
+		errs = append(errs, fmt.Errorf(s, args...))
+	}
+
+	var paramsFile string
+	if autoRunPostProcessor && len(postProcessorScripts) > 0 {
+		var err error
+		paramsFile, err = writeParamsFile(params)
 		if err != nil {
-			addError("error switching directories to %q to run post-processor: %s", outputRoot, err.Error())
-			break
+			addError("error writing params file for post-processor: %s", err.Error())
+			return output, errs
 		}
+		defer os.Remove(paramsFile)
+	}
+	for _, postProcessorScript := range postProcessorScripts {
+		fullRelativePath := filepath.Join(outputRoot, postProcessorScript)
 
-		err = os.Chmod(fullRelativePath, 0755)
+		err := outputFS.Chmod(fullRelativePath, 0755)
 		if err != nil {
 			addError("error chmod'ing post-processor to 755: %s", err.Error())
 			break
 		}
 
 		if autoRunPostProcessor {
-			Printfln("running post-processor at %q", fullRelativePath)
+			logf("running post-processor at %q", fullRelativePath)
 
-			cmd := exec.Command(fullRelativePath)
-			stdoutStderr, err := cmd.CombinedOutput()
-			Printfln("\npost-processor output:\n%s\n", stdoutStderr)
+			// The script path is made absolute, since a relative path would
+			// be resolved relative to cmd.Dir.
+			absOutputRoot, err := filepath.Abs(outputRoot)
+			if err != nil {
+				addError("error finding absolute path of %q: %s", outputRoot, err.Error())
+				break
+			}
+			scriptContent, err := outputFS.ReadFile(fullRelativePath)
+			if err == nil {
+				err = sandbox.checkScript(postProcessorScript, scriptContent)
+			}
+			if err != nil {
+				addError("error running post-processor: %s", err.Error())
+				break
+			}
+			cmd, cleanup, err := sandbox.command(
+				context.Background(),
+				absOutputRoot,
+				filepath.Join(absOutputRoot, postProcessorScript),
+				nil,
+				absOutputRoot,
+				postProcessorEnv(absOutputRoot, paramsFile, params),
+				logf,
+			)
+			if err != nil {
+				addError("error running post-processor: %s", err.Error())
+				break
+			}
+			scriptOutput := newLogWriter(logf, "post-processor: ")
+			cmd.Stdout = scriptOutput
+			cmd.Stderr = scriptOutput
+			err = cmd.Run()
+			scriptOutput.Flush()
+			cleanup()
+			output = append(output, scriptOutput.Output...)
 			if err != nil {
 				addError("error running post-processor: %s", err.Error())
 				break
 			}
 
-			Printfln("removing post-processor file %q", fullRelativePath)
-			err = os.Remove(fullRelativePath)
+			logf("removing post-processor file %q", fullRelativePath)
+			err = outputFS.Remove(fullRelativePath)
 			if err != nil {
 				addError("error removing post-processor file: %s", err.Error())
 				break
 			}
 		} else {
-			Printfln(`
+			logf(`
 
 !!!! MANUAL STEP !!!!
 Examine the post-processor script for safety, then run it if you're comfortable.
@@ -211,9 +365,223 @@ The post-processor command is:
     %s
 `, fullRelativePath)
 		}
+	}
+
+	return output, errs
+}
+
+// Render executes the templates and returns each output file, keyed by its
+// path in the output directory. The templates are read from templateFS,
+// beneath inputRoot. Nothing is written.
+//
+// Each DirsMapping directory gets its own instance of the template engine,
+// from newTemplateMgr, since its templates are named, and refer to each
+// other, by their paths relative to the directory. Two directories may each
+// have a template with the same name.
+//
+// Up to jobs templates are executed in parallel. The output, and the order of
+// the errors and progress messages, are the same for any number of jobs.
+func Render(
+	newTemplateMgr func() TemplateMgr,
+	inputRoot string,
+	outputRoot string,
+	config Config,
+	params Params,
+	jobs int,
+	templateFS fs.FS,
+	logf Logf,
+) (map[string]OutputFile, []error) {
+	var errs []error
+	addError := func(s string, args ...any) {
+		errs = append(errs, fmt.Errorf(s, args...))
+	}
+	addTemplateError := func(file string, line int, s string, args ...any) {
+		errs = append(errs, &TemplateError{file, line, fmt.Errorf(s, args...)})
+	}
+
+	// Load every input file, and parse every template, before executing any
+	// of them. Templates may refer to each other (e.g. partials, or extended
+	// base templates), so each template must be parsed before any template
+	// which refers to it executes.
+	conditions, conditionErrs := parseConditions(config.Conditions)
+	fileModes, fileModeErrs := parseFileModes(config.FileModes)
+	if len(conditionErrs) > 0 || len(fileModeErrs) > 0 {
+		return nil, append(conditionErrs, fileModeErrs...)
+	}
+
+	type inputFile struct {
+		templateMgr  TemplateMgr
+		templateName string
+		sourcePath   string
+		targetSubdir string
+		contents     []byte
+		mode         os.FileMode
+		isTemplate   bool
+	}
+	var inputFiles []inputFile
+	for _, inputSubdir := range slices.Sorted(maps.Keys(config.DirsMapping)) {
+		targetSubdir := config.DirsMapping[inputSubdir]
+		templateMgr := newTemplateMgr()
+		templatesLoader := MakeFileLoader(
+			templateFS,
+			inputRoot,
+			inputSubdir,
+		)
+
+		// Find all files in the input directory.
+		templateNames, err := templatesLoader.FindFiles()
+		if err != nil {
+			addError("error listing input files in %q: %s", path.Join(inputRoot, inputSubdir), err.Error())
+			return nil, errs
+		}
+		if len(templateNames) == 0 {
+			addError("no input files found in %q", inputRoot)
+			return nil, errs
+		}
+
+		for _, templateName := range templateNames {
+			// If the file extension isn't recognized as a template file type,
+			// assume it's a non-templated file and just copy it over directly.
+			isTemplate := filepath.Ext(templateName) == config.TemplateTypeExt
 
-		break
+			// Conditions match the name without the template extension, like
+			// FileModes, so that a glob means the same in both.
+			conditionName := templateName
+			if isTemplate {
+				conditionName = strings.TrimSuffix(templateName, config.TemplateTypeExt)
+			}
+			excludedBy := excludedByCondition(conditions, conditionName)
+			if excludedBy != "" {
+				logf("excluding %s by condition %q", filepath.Join(inputSubdir, templateName), excludedBy)
+				continue
+			}
+
+			templateContents, err := templatesLoader.LoadFileAsBytes(templateName)
+			if err != nil {
+				addError("error reading template %q: %s", templateName, err.Error())
+				continue
+			}
+
+			mode, err := templatesLoader.FileMode(templateName)
+			if err != nil {
+				addError("error reading mode of template %q: %s", templateName, err.Error())
+				continue
+			}
+
+			if isTemplate {
+				err = templateMgr.ParseOne(templateName, templateContents)
+				if err != nil {
+					addTemplateError(filepath.Join(inputSubdir, templateName), ErrorLine(templateName, err),
+						"error parsing template %q: %s", templateName, err.Error())
+					continue
+				}
+			}
+
+			inputFiles = append(inputFiles, inputFile{
+				templateMgr:  templateMgr,
+				templateName: templateName,
+				sourcePath:   filepath.Join(inputSubdir, templateName),
+				targetSubdir: targetSubdir,
+				contents:     templateContents,
+				mode:         mode,
+				isTemplate:   isTemplate,
+			})
+		}
+	}
+
+	// Execute the templates, fanned out across the given number of workers.
+	// Each output is kept at the index of its input file, so that everything
+	// after this is done in the same order as a sequential render.
+	type executedFile struct {
+		output bytes.Buffer
+		err    error
+	}
+	executed := make([]executedFile, len(inputFiles))
+	inputIndexes := make(chan int)
+	var workers sync.WaitGroup
+	for range max(1, min(jobs, len(inputFiles))) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range inputIndexes {
+				input := inputFiles[i]
+				if input.isTemplate {
+					executed[i].err = input.templateMgr.Execute(input.templateName, params, &executed[i].output)
+				} else {
+					executed[i].output.Write(input.contents)
+				}
+			}
+		}()
+	}
+	for i := range inputFiles {
+		inputIndexes <- i
+	}
+	close(inputIndexes)
+	workers.Wait()
+
+	// Process each input file, generating a corresponding output file in the
+	// output directory.
+	outputContents := map[string]OutputFile{}
+	for i, input := range inputFiles {
+		templateName := input.templateName
+		targetSubdir := input.targetSubdir
+
+		output := &executed[i].output
+		if input.isTemplate {
+			err := executed[i].err
+			if err != nil {
+				addTemplateError(input.sourcePath, ErrorLine(templateName, err), "error executing template: %s", err.Error())
+				continue
+			}
+			templateName = strings.TrimSuffix(templateName, config.TemplateTypeExt)
+		}
+
+		// Prepare output content, but don't write it yet, until we're
+		// confident there are no processing errors in any templates.
+		outputSubdirPath := filepath.Join(outputRoot, targetSubdir)
+		realTemplateName, hasFileMapping := config.FilesMapping[templateName]
+		if !hasFileMapping {
+			// This is the common case. Most file names *won't* need to be
+			// rewritten with params-aware name components.
+			realTemplateName = templateName
+		} else {
+			logf("Remap filename %q -> %q", templateName, realTemplateName)
+		}
+
+		// Resolve any template expressions or __param__ placeholders in the
+		// path itself, e.g. "cmd/{{ .service_name }}/main.go".
+		renderedName, err := renderPath(input.templateMgr, realTemplateName, params)
+		if err != nil {
+			addTemplateError(input.sourcePath, 0, "%s", err.Error())
+			continue
+		}
+		if renderedName != realTemplateName {
+			logf("Render filename %q -> %q", realTemplateName, renderedName)
+		}
+
+		outputPath := filepath.Join(outputSubdirPath, renderedName)
+		existing, hasPath := outputContents[outputPath]
+		if hasPath {
+			addError("at least two template files map to the same output location: %s (from %s and %s)", outputPath, existing.Template, input.sourcePath)
+			continue
+		}
+
+		outputBytes := bytes.TrimSpace(output.Bytes())
+		if len(outputBytes) == 0 {
+			logf("skipping output file with no output: %s", outputPath)
+			continue
+		}
+		outputFile := OutputFile{
+			Content:   output.Bytes(),
+			Template:  input.sourcePath,
+			MappedDir: targetSubdir,
+			Mode:      overrideFileMode(fileModes, renderedName, input.mode),
+		}
+		if renderedName != templateName {
+			outputFile.RemappedFrom = templateName
+		}
+		outputContents[outputPath] = outputFile
 	}
 
-	return errs
+	return outputContents, errs
 }
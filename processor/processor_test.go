@@ -0,0 +1,435 @@
+package processor_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestRenderConditions(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"templates/main.go.gotmpl":          "package {{ .name }}\n",
+		"templates/db/schema.sql":           "CREATE TABLE t;\n",
+		"templates/db/db.go.gotmpl":         "{{ .missing_param }}\n",
+		"templates/kafka/consumer.go":       "package kafka\n",
+		"templates/scripts/lint.sh":         "golint\n",
+		"templates/scripts/empty.txt":       "\n",
+		"templates/scripts/release.sh":      "release\n",
+		"templates/docs/README.md.gotmpl":   "docs\n",
+		"templates/docs/DESIGN.md.gotmpl":   "design\n",
+		"templates/docs/CHANGES.md.gotmpl":  "changes\n",
+		"templates/docs/NOTES.md.gotmpl":    "notes\n",
+		"templates/docs/internal/notes.txt": "notes\n",
+	})
+
+	config := processor.Config{
+		TemplateTypeExt: ".gotmpl",
+		DirsMapping: map[string]string{
+			"templates": "out",
+		},
+		Conditions: map[string]string{
+			// Values are already resolved from template expressions.
+			"db/**":            "false",
+			"kafka":            " true ",
+			"scripts/rel*.sh":  "False",
+			"docs/**/*.txt":    "",
+			"docs/DESIGN.md.*": "TRUE",
+			// Like FileModes, Conditions match names without the template
+			// extension, and before FilesMapping renames them.
+			"docs/CHANGES.md": "false",
+			"docs/NOTES.md":   "false",
+		},
+		FileModes:    map[string]string{"docs/*.md": "0600"},
+		FilesMapping: map[string]string{"docs/NOTES.md": "docs/TODO.md"},
+	}
+
+	outputContents, errs := processor.Render(
+		processor.GoTemplateMgr,
+		".",
+		"/output",
+		config,
+		processor.Params{"name": "svc"},
+		1,
+		os.DirFS(inputRoot),
+		processor.Printfln,
+	)
+	require.Empty(t, errs)
+
+	var outputPaths []string
+	for path := range outputContents {
+		outputPaths = append(outputPaths, path)
+	}
+	require.ElementsMatch(t, []string{
+		"/output/out/main.go",
+		"/output/out/kafka/consumer.go",
+		"/output/out/scripts/lint.sh",
+		"/output/out/docs/README.md",
+		"/output/out/docs/DESIGN.md",
+	}, outputPaths)
+	require.Equal(t, os.FileMode(0600), outputContents["/output/out/docs/README.md"].Mode)
+
+	mainGo := outputContents[filepath.Join("/output/out/main.go")]
+	require.Equal(t, "package svc\n", string(mainGo.Content))
+	require.Equal(t, "templates/main.go.gotmpl", mainGo.Template)
+}
+
+func TestRenderConditionsInvalid(t *testing.T) {
+	config := processor.Config{
+		TemplateTypeExt: ".gotmpl",
+		Conditions: map[string]string{
+			"db/**": "maybe",
+		},
+	}
+
+	_, errs := processor.Render(processor.GoTemplateMgr, ".", "/output", config, processor.Params{}, 1, os.DirFS(t.TempDir()), processor.Printfln)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], `condition for "db/**" must resolve to true or false, got "maybe"`)
+}
+
+func TestRenderTemplatedPaths(t *testing.T) {
+	testCases := []struct {
+		ext         string
+		templateMgr func() processor.TemplateMgr
+		expression  string
+	}{
+		{".gotmpl", processor.GoTemplateMgr, "{{ .name }}"},
+		{".jet", processor.JetTemplateMgr, "{{ .name }}"},
+		{".pongo", processor.PongoTemplateMgr, "{{ PARAMS.name }}"},
+		{".mustache", processor.MustacheTemplateMgr, "{{ name }}"},
+	}
+
+	for _, testCase := range testCases {
+		inputRoot := t.TempDir()
+		writeFiles(t, inputRoot, map[string]string{
+			"templates/cmd/" + testCase.expression + "/main.go" + testCase.ext: "package main\n",
+			"templates/__name___client/client.go":                              "package client\n",
+			"templates/pkg/__init__.py":                                        "\n# python\n",
+		})
+
+		config := processor.Config{
+			TemplateTypeExt: testCase.ext,
+			DirsMapping:     map[string]string{"templates": "out"},
+		}
+		outputContents, errs := processor.Render(
+			testCase.templateMgr,
+			".",
+			"/output",
+			config,
+			processor.Params{"name": "rss_reader"},
+			1,
+			os.DirFS(inputRoot),
+			processor.Printfln,
+		)
+		require.Empty(t, errs, testCase.ext)
+
+		var outputPaths []string
+		for path := range outputContents {
+			outputPaths = append(outputPaths, path)
+		}
+		require.ElementsMatch(t, []string{
+			"/output/out/cmd/rss_reader/main.go",
+			"/output/out/rss_reader_client/client.go",
+			"/output/out/pkg/__init__.py",
+		}, outputPaths, testCase.ext)
+	}
+}
+
+func TestRenderTemplatedPathCollision(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"templates/cmd/{{ .name }}.go": "a\n",
+		"templates/cmd/__name__.go":    "b\n",
+	})
+
+	config := processor.Config{
+		TemplateTypeExt: ".gotmpl",
+		DirsMapping:     map[string]string{"templates": "out"},
+	}
+	_, errs := processor.Render(processor.GoTemplateMgr, ".", "/output", config, processor.Params{"name": "svc"}, 1, os.DirFS(inputRoot), processor.Printfln)
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "at least two template files map to the same output location: /output/out/cmd/svc.go (from templates/cmd/__name__.go and templates/cmd/{{ .name }}.go)")
+}
+
+func TestRenderFileModes(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"templates/scripts/build.sh.gotmpl":  "go build\n",
+		"templates/scripts/deploy.sh":        "deploy\n",
+		"templates/scripts/secret.env":       "KEY=value\n",
+		"templates/scripts/private/setup.sh": "setup\n",
+		"templates/README.md":                "readme\n",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(inputRoot, "templates/scripts/build.sh.gotmpl"), 0755))
+	require.NoError(t, os.Chmod(filepath.Join(inputRoot, "templates/scripts/deploy.sh"), 0750))
+
+	config := processor.Config{
+		TemplateTypeExt: ".gotmpl",
+		DirsMapping:     map[string]string{"templates": "out"},
+		FileModes: map[string]string{
+			"scripts/*.env":            "0600",
+			"scripts/**":               "0700",
+			"scripts/private/setup.sh": "0500",
+		},
+	}
+	outputContents, errs := processor.Render(processor.GoTemplateMgr, ".", "/output", config, processor.Params{}, 1, os.DirFS(inputRoot), processor.Printfln)
+	require.Empty(t, errs)
+
+	modes := map[string]os.FileMode{}
+	for path, outputFile := range outputContents {
+		modes[path] = outputFile.Mode
+	}
+	require.Equal(t, map[string]os.FileMode{
+		"/output/out/scripts/build.sh":         0700,
+		"/output/out/scripts/deploy.sh":        0700,
+		"/output/out/scripts/secret.env":       0600,
+		"/output/out/scripts/private/setup.sh": 0500,
+		"/output/out/README.md":                0644,
+	}, modes)
+
+	delete(config.FileModes, "scripts/**")
+	outputContents, errs = processor.Render(processor.GoTemplateMgr, ".", "/output", config, processor.Params{}, 1, os.DirFS(inputRoot), processor.Printfln)
+	require.Empty(t, errs)
+	require.Equal(t, os.FileMode(0755), outputContents["/output/out/scripts/build.sh"].Mode)
+	require.Equal(t, os.FileMode(0750), outputContents["/output/out/scripts/deploy.sh"].Mode)
+
+	config.FileModes["README.md"] = "rwx"
+	_, errs = processor.Render(processor.GoTemplateMgr, ".", "/output", config, processor.Params{}, 1, os.DirFS(inputRoot), processor.Printfln)
+	require.Len(t, errs, 1)
+}
+
+func TestStageOutputInMemory(t *testing.T) {
+	templateFS := processor.NewMemFS()
+	require.NoError(t, templateFS.WriteFile("templates/main.go.gotmpl", []byte("package {{ .name }}\n"), 0644))
+	require.NoError(t, templateFS.WriteFile("templates/run.sh", []byte("#!/bin/sh\n"), 0755))
+
+	config := processor.Config{
+		TemplateTypeExt: ".gotmpl",
+		DirsMapping:     map[string]string{"templates": "out"},
+	}
+	params := processor.Params{"name": "svc"}
+	outputContents, errs := processor.Render(processor.GoTemplateMgr, ".", "/output", config, params, 1, templateFS, processor.Printfln)
+	require.Empty(t, errs)
+
+	outputFS := processor.NewMemOutputFS()
+	tx, err := processor.BeginTransaction(outputFS, "/output", processor.Printfln)
+	require.NoError(t, err)
+	_, errs = processor.StageOutput(
+		outputContents,
+		"/output",
+		processor.TemplateSource{Config: "config.hjson"},
+		"/output/digest.json",
+		false,
+		nil,
+		params,
+		tx,
+		processor.Printfln,
+	)
+	require.Empty(t, errs)
+	require.NoError(t, tx.Commit(context.Background()))
+
+	mainGo, err := fs.ReadFile(outputFS.Files, "output/out/main.go")
+	require.NoError(t, err)
+	require.Equal(t, "package svc\n", string(mainGo))
+
+	info, err := fs.Stat(outputFS.Files, "output/out/run.sh")
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode())
+
+	digestBytes, err := fs.ReadFile(outputFS.Files, "output/digest.json")
+	require.NoError(t, err)
+	digest, err := processor.ParseDigest(digestBytes)
+	require.NoError(t, err)
+	require.Equal(t, []string{"out/main.go", "out/run.sh"}, digest.Paths())
+
+	_, err = fs.Stat(outputFS.Files, "output/digest.base/out/main.go")
+	require.NoError(t, err)
+
+	// A skipped file isn't written, so it keeps its previous base.
+	params = processor.Params{"name": "api"}
+	outputContents, errs = processor.Render(processor.GoTemplateMgr, ".", "/output", config, params, 1, templateFS, processor.Printfln)
+	require.Empty(t, errs)
+	result, errs := processor.StageOutput(
+		outputContents,
+		"/output",
+		processor.TemplateSource{Config: "config.hjson"},
+		"/output/digest.json",
+		true,
+		map[string]processor.DigestFile{"out/main.go": digest.Files[0]},
+		params,
+		outputFS,
+		processor.Printfln,
+	)
+	require.Empty(t, errs)
+	require.Equal(t, []string{"out/main.go"}, result.Skipped)
+	baseMainGo, err := fs.ReadFile(outputFS.Files, "output/digest.base/out/main.go")
+	require.NoError(t, err)
+	require.Equal(t, "package svc\n", string(baseMainGo))
+	_, err = fs.Stat(outputFS.Files, "output/digest.base/out/run.sh")
+	require.NoError(t, err)
+}
+
+var syntheticEngines = []struct {
+	ext         string
+	templateMgr func() processor.TemplateMgr
+	body        string
+}{
+	{".gotmpl", processor.GoTemplateMgr, `package {{ .name }} // {{ PascalCase .name }} %d`},
+	{".jet", processor.JetTemplateMgr, `package {{ .name }} // {{ PascalCase(.name) }} %d`},
+	{".pongo", processor.PongoTemplateMgr, `package {{ PARAMS.name }} // {{ PascalCase(PARAMS.name) }} %d`},
+	{".mustache", processor.MustacheTemplateMgr, `package {{ name }} // {{#PascalCase}}{{ name }}{{/PascalCase}} %d`},
+}
+
+// syntheticTemplate builds a template tree of n files, spread across
+// directories, half of them templated.
+func syntheticTemplate(n int, ext string, body string) *processor.MemFS {
+	templateFS := processor.NewMemFS()
+	for i := range n {
+		name := fmt.Sprintf("templates/dir%d/file%d.go", i%10, i)
+		content := fmt.Sprintf("// static file %d\n", i)
+		if i%2 == 0 {
+			name += ext
+			content = fmt.Sprintf(body, i)
+		}
+		templateFS.WriteFile(name, []byte(content), 0644)
+	}
+	return templateFS
+}
+
+func TestRenderParallel(t *testing.T) {
+	for _, engine := range syntheticEngines {
+		t.Run(engine.ext, func(t *testing.T) {
+			templateFS := syntheticTemplate(200, engine.ext, engine.body)
+			config := processor.Config{
+				TemplateTypeExt: engine.ext,
+				DirsMapping:     map[string]string{"templates": "."},
+				FilesMapping:    map[string]string{"dir1/file1.go": "dir3/file3.go", "dir5/file5.go": "dir7/file7.go"},
+			}
+
+			render := func(jobs int) (map[string]processor.OutputFile, []error, []string) {
+				var logLines []string
+				outputContents, errs := processor.Render(
+					engine.templateMgr,
+					".",
+					"/output",
+					config,
+					processor.Params{"name": "svc"},
+					jobs,
+					templateFS,
+					func(format string, args ...any) {
+						logLines = append(logLines, fmt.Sprintf(format, args...))
+					},
+				)
+				return outputContents, errs, logLines
+			}
+
+			expectedContents, expectedErrs, expectedLogLines := render(1)
+			require.Len(t, expectedContents, 198)
+			require.Equal(t, "package svc // Svc 100", string(expectedContents["/output/dir0/file100.go"].Content))
+			require.Len(t, expectedErrs, 2)
+			require.ErrorContains(t, expectedErrs[0], "dir3/file3.go (from templates/dir1/file1.go and templates/dir3/file3.go)")
+			require.ErrorContains(t, expectedErrs[1], "dir7/file7.go (from templates/dir5/file5.go and templates/dir7/file7.go)")
+
+			for range 5 {
+				outputContents, errs, logLines := render(8)
+				require.Equal(t, expectedContents, outputContents)
+				require.Equal(t, expectedErrs, errs)
+				require.Equal(t, expectedLogLines, logLines)
+			}
+		})
+	}
+}
+
+func TestRenderDuplicateNames(t *testing.T) {
+	testCases := []struct {
+		ext         string
+		templateMgr func() processor.TemplateMgr
+		body        string
+	}{
+		{".gotmpl", processor.GoTemplateMgr, `%s {{ .name }} {{ template "part.gotmpl" . }}`},
+		{".jet", processor.JetTemplateMgr, `%s {{ .name }} {{ include "part.jet" }}`},
+		{".pongo", processor.PongoTemplateMgr, `%s {{ PARAMS.name }} {% include "part.pongo" %}`},
+		{".mustache", processor.MustacheTemplateMgr, `%s {{ name }} {{> part }}`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.ext, func(t *testing.T) {
+			// Each directory has its own index and partial, by the same names.
+			templateFS := processor.NewMemFS()
+			for _, dir := range []string{"a", "b"} {
+				templateFS.WriteFile(dir+"/index.html"+testCase.ext, []byte(strings.Replace(testCase.body, "%s", strings.ToUpper(dir), 1)), 0644)
+				templateFS.WriteFile(dir+"/part"+testCase.ext, []byte(dir+" partial"), 0644)
+			}
+			config := processor.Config{
+				TemplateTypeExt: testCase.ext,
+				DirsMapping:     map[string]string{"a": "outa", "b": "outb"},
+			}
+
+			for _, jobs := range []int{1, 8} {
+				outputContents, errs := processor.Render(testCase.templateMgr, ".", "/output", config, processor.Params{"name": "svc"}, jobs, templateFS, processor.Printfln)
+				require.Empty(t, errs)
+				require.Equal(t, "A svc a partial", string(outputContents["/output/outa/index.html"].Content))
+				require.Equal(t, "B svc b partial", string(outputContents["/output/outb/index.html"].Content))
+				require.Equal(t, "a partial", string(outputContents["/output/outa/part"].Content))
+				require.Equal(t, "b partial", string(outputContents["/output/outb/part"].Content))
+			}
+		})
+	}
+}
+
+func TestRenderParallelErrors(t *testing.T) {
+	templateFS := processor.NewMemFS()
+	for i := range 50 {
+		templateFS.WriteFile(fmt.Sprintf("templates/file%02d.gotmpl", i), []byte(fmt.Sprintf("{{ .missing%02d }}", i)), 0644)
+	}
+	config := processor.Config{
+		TemplateTypeExt: ".gotmpl",
+		DirsMapping:     map[string]string{"templates": "."},
+	}
+
+	_, expectedErrs := processor.Render(processor.GoTemplateMgr, ".", "/output", config, processor.Params{}, 1, templateFS, processor.Printfln)
+	require.Len(t, expectedErrs, 50)
+	require.ErrorContains(t, expectedErrs[0], "missing00")
+	require.ErrorContains(t, expectedErrs[49], "missing49")
+
+	_, errs := processor.Render(processor.GoTemplateMgr, ".", "/output", config, processor.Params{}, 8, templateFS, processor.Printfln)
+	require.Equal(t, expectedErrs, errs)
+}
+
+// BenchmarkRender compares rendering a large template tree sequentially with
+// rendering it in parallel, with each engine.
+func BenchmarkRender(b *testing.B) {
+	for _, engine := range syntheticEngines {
+		templateFS := syntheticTemplate(2000, engine.ext, engine.body)
+		config := processor.Config{
+			TemplateTypeExt: engine.ext,
+			DirsMapping:     map[string]string{"templates": "."},
+		}
+		for _, jobs := range []int{1, 8} {
+			b.Run(fmt.Sprintf("%s/jobs=%d", strings.TrimPrefix(engine.ext, "."), jobs), func(b *testing.B) {
+				for b.Loop() {
+					_, errs := processor.Render(
+						engine.templateMgr,
+						".",
+						"/output",
+						config,
+						processor.Params{"name": "svc"},
+						jobs,
+						templateFS,
+						func(string, ...any) {},
+					)
+					if len(errs) > 0 {
+						b.Fatal(errs)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PromptParams interactively asks the user for a value for each param. The
+// params to ask for are the union of those in defaults and those declared in
+// schema. Each question offers the value in defaults, if any, which is
+// accepted by entering an empty answer. Answers which can't be parsed, or
+// which violate the schema, are reported and the question is asked again.
+func PromptParams(input io.Reader, output io.Writer, defaults Params, schema ParamsSchema) (Params, error) {
+	p := prompter{
+		in:  bufio.NewReader(input),
+		out: output,
+	}
+	values, err := p.promptObject("", defaults, schema)
+	if err != nil {
+		return nil, err
+	}
+	return Params(values), nil
+}
+
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p prompter) promptObject(path string, defaults map[string]any, schema ParamsSchema) (map[string]any, error) {
+	names := slices.Collect(maps.Keys(defaults))
+	for name := range schema {
+		if _, hasDefault := defaults[name]; !hasDefault {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	values := map[string]any{}
+	for _, name := range names {
+		paramPath := joinParamPath(path, name)
+		paramSchema := schema[name]
+		defaultValue := defaults[name]
+
+		kind := paramSchema.Type
+		if kind == "" {
+			kind = inferParamType(defaultValue)
+		}
+
+		if kind == "object" {
+			defaultFields, _ := toStringMap(defaultValue)
+			fields, err := p.promptObject(paramPath, defaultFields, paramSchema.Properties)
+			if err != nil {
+				return nil, err
+			}
+			values[name] = fields
+			continue
+		}
+
+		value, err := p.promptValue(paramPath, kind, defaultValue, paramSchema)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+func (p prompter) promptValue(path string, kind string, defaultValue any, schema ParamSchema) (any, error) {
+	for {
+		if schema.Description != "" {
+			fmt.Fprintf(p.out, "# %s\n", schema.Description)
+		}
+
+		question := path
+		switch {
+		case len(schema.Enum) > 0:
+			fmt.Fprintf(p.out, "%s:\n", path)
+			for i, option := range schema.Enum {
+				fmt.Fprintf(p.out, "  %d. %v\n", i+1, option)
+			}
+			question = "choose"
+		case kind == "bool":
+			question += " (yes/no)"
+		case kind == "list":
+			question += " (comma-separated)"
+		}
+		if defaultValue != nil {
+			question += fmt.Sprintf(" [%s]", formatAnswer(defaultValue))
+		}
+		fmt.Fprintf(p.out, "%s: ", question)
+
+		answer, err := p.in.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			fmt.Fprintln(p.out)
+			return nil, fmt.Errorf("no answer for param %s: %s", path, err.Error())
+		}
+		answer = strings.TrimSpace(answer)
+
+		var value any
+		switch {
+		case answer == "" && defaultValue != nil:
+			value = defaultValue
+			if f, isFloat := value.(float64); isFloat && kind == "int" && f == float64(int(f)) {
+				// hjson decodes all numbers as floats. Keep whole numbers
+				// looking like whole numbers when the params are rewritten.
+				value = int(f)
+			}
+		case answer == "" && !schema.Required:
+			return nil, nil
+		case answer == "":
+			fmt.Fprintf(p.out, "a value is required\n")
+			continue
+		case len(schema.Enum) > 0:
+			value = parseChoice(answer, schema.Enum)
+		default:
+			value, err = parseAnswer(answer, kind, schema.Items)
+			if err != nil {
+				fmt.Fprintf(p.out, "%s\n", err.Error())
+				continue
+			}
+		}
+
+		var errs []error
+		schema.validate(path, value, &errs)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(p.out, "%s\n", err.Error())
+			}
+			continue
+		}
+		return value, nil
+	}
+}
+
+// inferParamType guesses a schema type from an example value, for params
+// which aren't declared in the schema.
+func inferParamType(value any) string {
+	switch value.(type) {
+	case bool:
+		return "bool"
+	case []any:
+		return "list"
+	case map[string]any, Params:
+		return "object"
+	}
+	if num, isNumber := toFloat64(value); isNumber {
+		if _, isFloat := value.(float64); isFloat && num != float64(int64(num)) {
+			return "number"
+		}
+		return "int"
+	}
+	return "string"
+}
+
+func parseChoice(answer string, options []any) any {
+	if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(options) {
+		return options[i-1]
+	}
+	for _, option := range options {
+		if fmt.Sprint(option) == answer {
+			return option
+		}
+	}
+	// Let schema validation report the bad answer.
+	return answer
+}
+
+func parseAnswer(answer string, kind string, items *ParamSchema) (any, error) {
+	switch kind {
+	case "bool":
+		switch strings.ToLower(answer) {
+		case "y", "yes", "true":
+			return true, nil
+		case "n", "no", "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("please answer yes or no")
+	case "int":
+		i, err := strconv.Atoi(answer)
+		if err != nil {
+			return nil, fmt.Errorf("please enter a whole number")
+		}
+		return i, nil
+	case "number":
+		f, err := strconv.ParseFloat(answer, 64)
+		if err != nil {
+			return nil, fmt.Errorf("please enter a number")
+		}
+		return f, nil
+	case "list":
+		itemKind := "string"
+		if items != nil && items.Type != "" {
+			itemKind = items.Type
+		}
+		var values []any
+		for _, part := range strings.Split(answer, ",") {
+			value, err := parseAnswer(strings.TrimSpace(part), itemKind, nil)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return answer, nil
+}
+
+func formatAnswer(value any) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
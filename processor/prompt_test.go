@@ -0,0 +1,81 @@
+package processor_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestPromptParams(t *testing.T) {
+	defaults := processor.Params{
+		"project_name": "BigPotato",
+		"use_postgres": true,
+		"replicas":     float64(3),
+		"tags":         []any{"a", "b"},
+		"owner": map[string]any{
+			"team": "potatoes",
+		},
+	}
+
+	minReplicas := 1.0
+	schema := processor.ParamsSchema{
+		"project_name": {Type: "string", Pattern: "[A-Za-z]+"},
+		"replicas":     {Type: "int", Min: &minReplicas},
+		"log_level":    {Type: "string", Enum: []any{"debug", "info"}, Required: true},
+	}
+
+	answers := strings.Join([]string{
+		"",           // log_level: required, no default
+		"trace",      // log_level: not a choice
+		"2",          // log_level: choice #2
+		"",           // owner.team: default
+		"Rss Reader", // project_name: violates pattern
+		"RssReader",  // project_name
+		"many",       // replicas: not a number
+		"0",          // replicas: below minimum
+		"",           // replicas: default
+		"x, y, z",    // tags
+		"maybe",      // use_postgres: not yes/no
+		"n",          // use_postgres
+	}, "\n")
+
+	var output bytes.Buffer
+	params, err := processor.PromptParams(strings.NewReader(answers), &output, defaults, schema)
+	require.NoError(t, err)
+
+	require.Equal(t, processor.Params{
+		"log_level":    "info",
+		"owner":        map[string]any{"team": "potatoes"},
+		"project_name": "RssReader",
+		"replicas":     3,
+		"tags":         []any{"x", "y", "z"},
+		"use_postgres": false,
+	}, params)
+
+	require.Equal(t, `log_level:
+  1. debug
+  2. info
+choose: a value is required
+log_level:
+  1. debug
+  2. info
+choose: param log_level: value trace is not one of [debug info]
+log_level:
+  1. debug
+  2. info
+choose: owner.team [potatoes]: project_name [BigPotato]: param project_name: value "Rss Reader" does not match pattern "[A-Za-z]+"
+project_name [BigPotato]: replicas [3]: please enter a whole number
+replicas [3]: param replicas: value 0 is less than the minimum 1
+replicas [3]: tags (comma-separated) [a, b]: use_postgres (yes/no) [yes]: please answer yes or no
+use_postgres (yes/no) [yes]: `,
+		output.String())
+}
+
+func TestPromptParamsEndOfInput(t *testing.T) {
+	var output bytes.Buffer
+	_, err := processor.PromptParams(strings.NewReader("Fizz\n"), &output, processor.Params{"bar": "x", "foo": "y"}, nil)
+	require.EqualError(t, err, "no answer for param foo: EOF")
+}
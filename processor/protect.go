@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ModifiedPolicy says what to do with a file from a previous run which the
+// user has modified since sprout generated it.
+type ModifiedPolicy string
+
+const (
+	// ModifiedSkip leaves the file in place, and doesn't overwrite it with
+	// new output.
+	ModifiedSkip ModifiedPolicy = "skip"
+	// ModifiedBackup moves the file to a timestamped backup directory, then
+	// replaces it with new output.
+	ModifiedBackup ModifiedPolicy = "backup"
+	// ModifiedOverwrite deletes the file, then replaces it with new output.
+	ModifiedOverwrite ModifiedPolicy = "overwrite"
+)
+
+// ParseModifiedPolicy validates a policy name given on the command line.
+func ParseModifiedPolicy(s string) (ModifiedPolicy, error) {
+	policy := ModifiedPolicy(s)
+	switch policy {
+	case ModifiedSkip, ModifiedBackup, ModifiedOverwrite:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unrecognized policy %q for modified files. expected %s, %s or %s", s, ModifiedSkip, ModifiedBackup, ModifiedOverwrite)
+}
+
+// BackupDir returns a new timestamped directory next to the digest, where
+// modified files are moved before they're replaced. If a run at the same
+// instant already used the directory, a numeric suffix is added.
+func BackupDir(absDigestPath string, now time.Time) string {
+	backupRoot := strings.TrimSuffix(absDigestPath, filepath.Ext(absDigestPath)) + ".backup"
+	backupDir := filepath.Join(backupRoot, now.Format("20060102-150405.000000000"))
+	candidate := backupDir
+	for i := 2; ; i++ {
+		_, err := os.Stat(candidate)
+		if err != nil {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", backupDir, i)
+	}
+}
+
+// BackupFile moves the output file at relPath into backupDir, at the same
+// relative path, through outputFS. In a Transaction, the move is staged like
+// any other change.
+func BackupFile(outputFS OutputFS, outputRoot string, backupDir string, relPath string) error {
+	outputPath := filepath.Join(outputRoot, relPath)
+	backupPath := filepath.Join(backupDir, relPath)
+	info, err := outputFS.Stat(outputPath)
+	if err != nil {
+		return err
+	}
+	content, err := outputFS.ReadFile(outputPath)
+	if err == nil {
+		err = outputFS.MkdirAll(filepath.Dir(backupPath), 0755)
+	}
+	if err == nil {
+		err = outputFS.WriteFile(backupPath, content, info.Mode().Perm())
+	}
+	if err == nil {
+		err = outputFS.Chmod(backupPath, info.Mode().Perm())
+	}
+	if err != nil {
+		return err
+	}
+	return outputFS.Remove(outputPath)
+}
@@ -0,0 +1,45 @@
+package processor_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestParseModifiedPolicy(t *testing.T) {
+	policy, err := processor.ParseModifiedPolicy("backup")
+	require.NoError(t, err)
+	require.Equal(t, processor.ModifiedBackup, policy)
+
+	_, err = processor.ParseModifiedPolicy("delete")
+	require.Error(t, err)
+}
+
+func TestBackupFile(t *testing.T) {
+	outputRoot := t.TempDir()
+	writeFiles(t, outputRoot, map[string]string{
+		"service/main.go": "edited",
+	})
+
+	now := time.Date(2024, 5, 6, 7, 8, 9, 10000, time.UTC)
+	backupDir := processor.BackupDir(filepath.Join(outputRoot, "digest.json"), now)
+	require.Equal(t, filepath.Join(outputRoot, "digest.backup", "20240506-070809.000010000"), backupDir)
+
+	err := processor.BackupFile(processor.DiskFS{}, outputRoot, backupDir, "service/main.go")
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(outputRoot, "service/main.go"))
+	require.True(t, os.IsNotExist(err))
+
+	backedUp, err := os.ReadFile(filepath.Join(backupDir, "service/main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "edited", string(backedUp))
+
+	// Another run at the same instant gets its own directory.
+	otherBackupDir := processor.BackupDir(filepath.Join(outputRoot, "digest.json"), now)
+	require.Equal(t, backupDir+"-2", otherBackupDir)
+}
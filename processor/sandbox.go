@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Sandbox restricts the commands run by a template's post-processor scripts
+// and hooks. Commands run by a nil *Sandbox are unrestricted.
+type Sandbox struct {
+	// Commands are the commands declared by the template. They're the only
+	// commands found on the PATH, and the only commands hooks may run.
+	Commands []string
+	// ScriptHashes maps the path of each post-processor script the user
+	// approved, relative to the output directory, to the SHA256 of its
+	// contents. Any other script, or a script with other contents, is
+	// refused.
+	ScriptHashes map[string]string
+	// Isolate runs each command in Linux user and mount namespaces, with a
+	// read-only view of the filesystem outside the output directory. The
+	// program must call MaybeRunSandboxed. If it doesn't, or namespaces aren't
+	// available, commands run without this isolation, and a warning is
+	// logged.
+	Isolate bool
+}
+
+// sandboxVariables are the environment variables which the sandbox sets for
+// each command, and which commands may not override.
+var sandboxVariables = []string{"PATH", "HOME", "TMPDIR"}
+
+// sandboxedCommand describes a command to be run inside the namespaces of an
+// isolated sandbox. It's passed to the re-executed sprout process, which sets
+// up the namespaces and then executes the command. See sandbox_linux.go.
+type sandboxedCommand struct {
+	Path     string
+	Args     []string
+	Env      []string
+	Writable []string
+	Probe    bool
+}
+
+// checkScript returns an error if the post-processor script isn't the one
+// that was approved.
+func (s *Sandbox) checkScript(script string, content []byte) error {
+	if s == nil {
+		return nil
+	}
+	approvedHash, isApproved := s.ScriptHashes[script]
+	if !isApproved {
+		return fmt.Errorf("post-processor %s wasn't approved", script)
+	}
+	if HashBytes(content) != approvedHash {
+		return fmt.Errorf("post-processor %s has changed since it was approved", script)
+	}
+	return nil
+}
+
+// command returns a command which runs name, with args, in dir, with env added
+// to its environment. name is the path of a post-processor script, or a
+// command name which is looked up on the PATH. outputRoot must be absolute.
+// The returned cleanup function must be called once the command has finished.
+func (s *Sandbox) command(
+	ctx context.Context,
+	outputRoot string,
+	name string,
+	args []string,
+	dir string,
+	env []string,
+	logf Logf,
+) (*exec.Cmd, func(), error) {
+	if s == nil {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), env...)
+		return cmd, func() {}, nil
+	}
+
+	// A path may only name a script in the output directory, i.e. a
+	// post-processor script. Any other command must be declared.
+	isPath := strings.ContainsRune(name, filepath.Separator)
+	if isPath && !strings.HasPrefix(name, filepath.Clean(outputRoot)+string(filepath.Separator)) {
+		return nil, nil, fmt.Errorf("command %q is outside the output directory", name)
+	}
+	if !isPath && !slices.Contains(s.Commands, name) {
+		return nil, nil, fmt.Errorf("command %q isn't among the template's declared commands: %s", name, strings.Join(s.Commands, ", "))
+	}
+
+	// The command's env may not override the variables which make the
+	// sandbox, e.g. to put undeclared commands on the PATH.
+	for _, variable := range env {
+		key, _, _ := strings.Cut(variable, "=")
+		if slices.Contains(sandboxVariables, key) {
+			return nil, nil, fmt.Errorf("command %q may not set %s, which the sandbox sets", name, key)
+		}
+	}
+
+	// Build a private directory for the PATH, holding a link to each
+	// declared command, and a home directory, which is the only writable
+	// directory besides the output directory.
+	sandboxDir, err := os.MkdirTemp("", "sprout-sandbox-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating sandbox directory: %s", err.Error())
+	}
+	cleanup := func() {
+		os.RemoveAll(sandboxDir)
+	}
+	binDir := filepath.Join(sandboxDir, "bin")
+	homeDir := filepath.Join(sandboxDir, "home")
+	err = os.Mkdir(binDir, 0755)
+	if err == nil {
+		err = os.Mkdir(homeDir, 0755)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("error creating sandbox directory: %s", err.Error())
+	}
+	for _, command := range s.Commands {
+		if command == "" || strings.ContainsRune(command, filepath.Separator) {
+			cleanup()
+			return nil, nil, fmt.Errorf("declared command %q must be the name of a command on the PATH", command)
+		}
+		commandPath, err := exec.LookPath(command)
+		if err == nil {
+			commandPath, err = filepath.Abs(commandPath)
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("error finding declared command %q: %s", command, err.Error())
+		}
+		err = os.Symlink(commandPath, filepath.Join(binDir, command))
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("error linking declared command %q: %s", command, err.Error())
+		}
+	}
+
+	path := name
+	if !isPath {
+		path = filepath.Join(binDir, name)
+	}
+
+	// Scrub the environment, keeping only the variables sprout sets.
+	sandboxEnv := []string{
+		"PATH=" + binDir,
+		"HOME=" + homeDir,
+		"TMPDIR=" + homeDir,
+	}
+	for _, key := range []string{"LANG", "TERM", "TZ"} {
+		isOverridden := slices.ContainsFunc(env, func(variable string) bool {
+			return strings.HasPrefix(variable, key+"=")
+		})
+		value, isSet := os.LookupEnv(key)
+		if isSet && !isOverridden {
+			sandboxEnv = append(sandboxEnv, key+"="+value)
+		}
+	}
+	sandboxEnv = append(sandboxEnv, env...)
+
+	if s.Isolate && !isolationAvailable() {
+		logf("WARNING: commands can't be isolated in Linux namespaces here, so %s will run with a writable view of the filesystem", name)
+	}
+	if !s.Isolate || !isolationAvailable() {
+		cmd := exec.CommandContext(ctx, path, args...)
+		cmd.Dir = dir
+		cmd.Env = sandboxEnv
+		return cmd, cleanup, nil
+	}
+
+	cmd, err := isolatedCommand(ctx, sandboxedCommand{
+		Path:     path,
+		Args:     append([]string{path}, args...),
+		Env:      sandboxEnv,
+		Writable: []string{outputRoot, homeDir},
+	})
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	cmd.Dir = dir
+	return cmd, cleanup, nil
+}
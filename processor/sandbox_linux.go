@@ -0,0 +1,272 @@
+package processor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// An isolated command is run by re-executing the running program, with the
+// command described in this environment variable, in new user and mount
+// namespaces. MaybeRunSandboxed sees the variable, makes the filesystem
+// read-only outside the writable directories, drops all capabilities, then
+// executes the command in place of the program.
+const sandboxEnvVar = "SPROUT_SANDBOXED_COMMAND"
+
+// canReexec is set by MaybeRunSandboxed, to show that the program can be
+// re-executed to run an isolated command.
+var canReexec bool
+
+// MaybeRunSandboxed runs the isolated command which the program was
+// re-executed for, if any, in which case it never returns. Programs which run
+// commands in a Sandbox with Isolate must call it first thing in main, or in
+// TestMain for tests. Otherwise, their commands aren't isolated.
+func MaybeRunSandboxed() {
+	spec, isSandboxed := os.LookupEnv(sandboxEnvVar)
+	if !isSandboxed {
+		canReexec = true
+		return
+	}
+	err := enterSandbox(spec)
+	fmt.Fprintf(os.Stderr, "sprout sandbox: %s\n", err.Error())
+	os.Exit(126)
+}
+
+// isolatedCommand returns a command which runs sc in new namespaces.
+func isolatedCommand(ctx context.Context, sc sandboxedCommand) (*exec.Cmd, error) {
+	spec, err := json.Marshal(sc)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding sandboxed command: %s", err.Error())
+	}
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Env = []string{sandboxEnvVar + "=" + string(spec)}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		// The user is root within the namespace, to set up the mounts.
+		// All capabilities are dropped before the command is executed.
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+	}
+	return cmd, nil
+}
+
+var isolationProbe struct {
+	once      sync.Once
+	available bool
+}
+
+// isolationAvailable reports whether user and mount namespaces can be created,
+// by trying it once. They may be unavailable in containers, or disabled by the
+// kernel configuration or by security modules, or the program may not call
+// MaybeRunSandboxed.
+func isolationAvailable() bool {
+	if !canReexec {
+		return false
+	}
+	isolationProbe.once.Do(func() {
+		cmd, err := isolatedCommand(context.Background(), sandboxedCommand{Probe: true})
+		if err == nil {
+			err = cmd.Run()
+		}
+		isolationProbe.available = err == nil
+	})
+	return isolationProbe.available
+}
+
+// enterSandbox runs in the re-executed program, inside the new namespaces. It
+// only returns if something fails.
+func enterSandbox(spec string) error {
+	var sc sandboxedCommand
+	err := json.Unmarshal([]byte(spec), &sc)
+	if err != nil {
+		return fmt.Errorf("error decoding sandboxed command: %s", err.Error())
+	}
+
+	// Credentials are per thread, and must be those of the thread which
+	// executes the command.
+	runtime.LockOSThread()
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error finding working directory: %s", err.Error())
+	}
+
+	// Keep the mounts below from propagating out of the namespace.
+	err = syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("error making mounts private: %s", err.Error())
+	}
+
+	// Bind mount each writable directory onto itself, so it's a separate
+	// mount which stays writable, then remount everything else read-only.
+	for _, dir := range sc.Writable {
+		err = syscall.Mount(dir, dir, "", syscall.MS_BIND|syscall.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("error mounting writable directory %s: %s", dir, err.Error())
+		}
+	}
+	mounts, err := readMounts()
+	if err != nil {
+		return fmt.Errorf("error reading mounts: %s", err.Error())
+	}
+	for _, mount := range mounts {
+		if slices.ContainsFunc(sc.Writable, func(dir string) bool { return isWithin(mount.point, dir) }) {
+			continue
+		}
+		err = syscall.Mount("", mount.point, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|mount.flags, "")
+		// Some special filesystems, e.g. within /proc, can't be remounted in
+		// a user namespace. They're left as they are.
+		if err != nil && mount.point == "/" {
+			return fmt.Errorf("error remounting / read-only: %s", err.Error())
+		}
+	}
+	if sc.Probe {
+		os.Exit(0)
+	}
+
+	// The working directory still refers to the directory beneath any new
+	// mount of it. Change to it again, to see the new mount.
+	err = os.Chdir(workingDir)
+	if err != nil {
+		return fmt.Errorf("error changing to working directory: %s", err.Error())
+	}
+
+	err = dropCapabilities()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(sc.Path, sc.Args, sc.Env)
+}
+
+// isWithin reports whether path is dir, or inside it.
+func isWithin(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, filepath.Clean(dir)+"/")
+}
+
+type mountPoint struct {
+	point string
+	flags uintptr
+}
+
+// readMounts returns the mount points of the mount namespace, and the flags
+// they're mounted with which must be kept when they're remounted.
+func readMounts() ([]mountPoint, error) {
+	mountInfo, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer mountInfo.Close()
+
+	optionFlags := map[string]uintptr{
+		"nosuid":      syscall.MS_NOSUID,
+		"nodev":       syscall.MS_NODEV,
+		"noexec":      syscall.MS_NOEXEC,
+		"noatime":     syscall.MS_NOATIME,
+		"nodiratime":  syscall.MS_NODIRATIME,
+		"relatime":    syscall.MS_RELATIME,
+		"strictatime": syscall.MS_STRICTATIME,
+	}
+
+	// Each line is like:
+	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+	// where the fifth field is the mount point, and the sixth its options.
+	var mounts []mountPoint
+	scanner := bufio.NewScanner(mountInfo)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		point, err := unescapeMountPoint(fields[4])
+		if err != nil {
+			return nil, err
+		}
+		var flags uintptr
+		for _, option := range strings.Split(fields[5], ",") {
+			flags |= optionFlags[option]
+		}
+		mounts = append(mounts, mountPoint{point, flags})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPoint decodes the octal escapes, like "\040" for a space, in a
+// mount point from /proc/self/mountinfo.
+func unescapeMountPoint(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			c, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("malformed mount point %q", s)
+			}
+			b.WriteByte(byte(c))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+// Capability constants, which the syscall package lacks.
+const (
+	prSetNoNewPrivs      = 38
+	secbitNoRoot         = 1 << 0
+	secbitNoRootLocked   = 1 << 1
+	secbitNoSetuidFixup  = 1 << 2
+	secbitNoSetuidLocked = 1 << 3
+	linuxCapabilityV3    = 0x20080522
+	capLastCap           = 63
+)
+
+// dropCapabilities ensures the command runs without any capabilities in the
+// namespace, so it can't undo the read-only mounts. The user is root within
+// the namespace, which would normally regain every capability on exec.
+func dropCapabilities() error {
+	for capability := 0; capability <= capLastCap; capability++ {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, uintptr(capability), 0)
+		// EINVAL means the capability isn't supported by this kernel.
+		if errno != 0 && errno != syscall.EINVAL {
+			return fmt.Errorf("error dropping capability %d: %s", capability, errno.Error())
+		}
+	}
+
+	securebits := secbitNoRoot | secbitNoRootLocked | secbitNoSetuidFixup | secbitNoSetuidLocked
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_SECUREBITS, uintptr(securebits), 0)
+	if errno != 0 {
+		return fmt.Errorf("error setting securebits: %s", errno.Error())
+	}
+
+	header := struct {
+		version uint32
+		pid     int32
+	}{linuxCapabilityV3, 0}
+	var data [2]struct {
+		effective   uint32
+		permitted   uint32
+		inheritable uint32
+	}
+	_, _, errno = syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data)), 0)
+	if errno != 0 {
+		return fmt.Errorf("error clearing capabilities: %s", errno.Error())
+	}
+
+	_, _, errno = syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	if errno != 0 {
+		return fmt.Errorf("error setting no_new_privs: %s", errno.Error())
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package processor
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// MaybeRunSandboxed does nothing, as commands are only isolated on Linux.
+func MaybeRunSandboxed() {}
+
+// isolationAvailable reports whether commands can be isolated in namespaces,
+// which are only available on Linux.
+func isolationAvailable() bool {
+	return false
+}
+
+func isolatedCommand(ctx context.Context, sc sandboxedCommand) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("sandbox isolation is only available on Linux")
+}
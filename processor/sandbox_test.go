@@ -0,0 +1,98 @@
+package processor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestMain(m *testing.M) {
+	// Isolated commands re-execute the test binary.
+	processor.MaybeRunSandboxed()
+	os.Exit(m.Run())
+}
+
+func TestSandboxHooks(t *testing.T) {
+	outputRoot := t.TempDir()
+	outsidePath := filepath.Join(t.TempDir(), "outside.txt")
+	t.Setenv("SPROUT_TEST_SECRET", "secret")
+
+	sandbox := &processor.Sandbox{
+		Commands: []string{"sh"},
+		Isolate:  runtime.GOOS == "linux",
+	}
+	steps := []processor.HookStep{
+		{Name: "write", Command: "sh", Args: []string{"-c", "echo inside > inside.txt"}},
+		{Name: "env", Command: "sh", Args: []string{"-c", "echo [$SPROUT_TEST_SECRET] [$GREETING]"}, Env: map[string]string{"GREETING": "hello"}},
+		{Name: "undeclared", Command: "sh", Args: []string{"-c", "cat inside.txt"}, OnFailure: processor.HookContinue},
+		{Name: "outside", Command: "sh", Args: []string{"-c", "echo outside > " + outsidePath}, OnFailure: processor.HookContinue},
+		{Name: "ls", Command: "ls"},
+	}
+	results, errs := processor.RunHooks(context.Background(), "PostGenerate", steps, outputRoot, true, sandbox, processor.Printfln)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], `error running PostGenerate hook "ls": command "ls" isn't among the template's declared commands: sh`)
+
+	require.Len(t, results, 5)
+	require.Empty(t, results[0].Error)
+	inside, err := os.ReadFile(filepath.Join(outputRoot, "inside.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "inside\n", string(inside))
+
+	require.Equal(t, "[] [hello]\n", string(results[1].Output))
+	require.Contains(t, string(results[2].Output), "cat: not found")
+
+	// A hook can't put undeclared commands on the PATH.
+	pathStep := processor.HookStep{Name: "path", Command: "sh", Args: []string{"-c", "cat inside.txt"}, Env: map[string]string{"PATH": "/usr/bin:/bin"}}
+	_, errs = processor.RunHooks(context.Background(), "PostGenerate", []processor.HookStep{pathStep}, outputRoot, true, sandbox, processor.Printfln)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], `command "sh" may not set PATH, which the sandbox sets`)
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if results[3].Error == "" {
+		t.Skip("Linux namespaces aren't available")
+	}
+	require.Contains(t, string(results[3].Output), "Read-only file system")
+	_, err = os.Stat(outsidePath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSandboxPostProcessor(t *testing.T) {
+	script := "#!/bin/sh\necho $SPROUT_PARAM_NAME\n"
+	runPostProcessor := func(sandbox *processor.Sandbox) ([]byte, []error) {
+		outputRoot := t.TempDir()
+		writeFiles(t, outputRoot, map[string]string{"post.sh": script})
+		return processor.RunPostProcessors(
+			outputRoot,
+			true,
+			[]string{"post.sh"},
+			sandbox,
+			processor.Params{"name": "svc"},
+			processor.DiskFS{},
+			processor.Printfln,
+		)
+	}
+
+	output, errs := runPostProcessor(&processor.Sandbox{
+		ScriptHashes: map[string]string{"post.sh": processor.HashBytes([]byte(script))},
+		Isolate:      true,
+	})
+	require.Empty(t, errs)
+	require.Equal(t, "svc\n", string(output))
+
+	_, errs = runPostProcessor(&processor.Sandbox{
+		ScriptHashes: map[string]string{"post.sh": processor.HashBytes([]byte("echo approved\n"))},
+	})
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "error running post-processor: post-processor post.sh has changed since it was approved")
+
+	_, errs = runPostProcessor(&processor.Sandbox{})
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs[0], "error running post-processor: post-processor post.sh wasn't approved")
+}
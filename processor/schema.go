@@ -0,0 +1,192 @@
+package processor
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+)
+
+// ParamsSchema declares the params a template expects. Each key names a
+// top-level param. The schema is checked against the user's params before
+// any template executes, so that every problem can be reported at once,
+// rather than failing on the first missing key mid-render.
+type ParamsSchema map[string]ParamSchema
+
+// ParamSchema describes the constraints on a single param value.
+//
+// Type is one of "string", "bool", "int", "number", "object" or "list". An
+// empty Type accepts any value. Min and Max bound the value of numbers, the
+// length of strings, in characters, and the length of lists. Pattern is a
+// regular expression which must match the entirety of a string value.
+// Properties describes the fields of an "object" param, and Items describes
+// every element of a "list" param.
+type ParamSchema struct {
+	Type        string
+	Description string
+	Required    bool
+	Enum        []any
+	Pattern     string
+	Min         *float64
+	Max         *float64
+	Properties  ParamsSchema
+	Items       *ParamSchema
+}
+
+// Validate checks params against the schema, and returns one error for each
+// violation found.
+func (s ParamsSchema) Validate(params Params) []error {
+	var errs []error
+	s.validateObject("", params, &errs)
+	return errs
+}
+
+func (s ParamsSchema) validateObject(path string, values map[string]any, errs *[]error) {
+	for _, name := range slices.Sorted(maps.Keys(s)) {
+		paramSchema := s[name]
+		paramPath := joinParamPath(path, name)
+		value, hasValue := values[name]
+		if !hasValue || value == nil {
+			if paramSchema.Required {
+				*errs = append(*errs, fmt.Errorf("param %s: required but not defined", paramPath))
+			}
+			continue
+		}
+		paramSchema.validate(paramPath, value, errs)
+	}
+}
+
+func (s ParamSchema) validate(path string, value any, errs *[]error) {
+	addError := func(format string, args ...any) {
+		*errs = append(*errs, fmt.Errorf("param %s: "+format, append([]any{path}, args...)...))
+	}
+
+	switch s.Type {
+	case "":
+		// Any value is acceptable.
+	case "string":
+		str, isString := value.(string)
+		if !isString {
+			addError("expected type %s, got %s", s.Type, describeValue(value))
+			return
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + s.Pattern + ")$")
+			if err != nil {
+				addError("invalid pattern %q in schema: %s", s.Pattern, err.Error())
+			} else if !re.MatchString(str) {
+				addError("value %q does not match pattern %q", str, s.Pattern)
+			}
+		}
+		s.checkBounds(float64(utf8.RuneCountInString(str)), "length", addError)
+	case "bool":
+		if _, isBool := value.(bool); !isBool {
+			addError("expected type %s, got %s", s.Type, describeValue(value))
+			return
+		}
+	case "int", "number":
+		num, isNumber := toFloat64(value)
+		if !isNumber {
+			addError("expected type %s, got %s", s.Type, describeValue(value))
+			return
+		}
+		if s.Type == "int" && num != math.Trunc(num) {
+			addError("expected type int, got %v", value)
+			return
+		}
+		s.checkBounds(num, "value", addError)
+	case "object":
+		fields, isObject := toStringMap(value)
+		if !isObject {
+			addError("expected type %s, got %s", s.Type, describeValue(value))
+			return
+		}
+		s.Properties.validateObject(path, fields, errs)
+	case "list":
+		items, isList := value.([]any)
+		if !isList {
+			addError("expected type %s, got %s", s.Type, describeValue(value))
+			return
+		}
+		s.checkBounds(float64(len(items)), "length", addError)
+		if s.Items != nil {
+			for i, item := range items {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	default:
+		addError("unrecognized type %q in schema", s.Type)
+		return
+	}
+
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(option any) bool {
+		return valuesEqual(option, value)
+	}) {
+		addError("value %v is not one of %v", value, s.Enum)
+	}
+}
+
+func (s ParamSchema) checkBounds(n float64, what string, addError func(string, ...any)) {
+	if s.Min != nil && n < *s.Min {
+		addError("%s %v is less than the minimum %v", what, n, *s.Min)
+	}
+	if s.Max != nil && n > *s.Max {
+		addError("%s %v is greater than the maximum %v", what, n, *s.Max)
+	}
+}
+
+func joinParamPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func describeValue(value any) string {
+	switch value.(type) {
+	case string:
+		return fmt.Sprintf("string %q", value)
+	case []any:
+		return "list"
+	case map[string]any, Params:
+		return "object"
+	}
+	return fmt.Sprintf("%T %v", value, value)
+}
+
+// toFloat64 converts any of the numeric types produced by the params file
+// decoders (hjson produces float64, yaml produces int, toml produces int64).
+func toFloat64(value any) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func toStringMap(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		return v, true
+	case Params:
+		return v, true
+	}
+	return nil, false
+}
+
+func valuesEqual(a any, b any) bool {
+	aNum, aIsNumber := toFloat64(a)
+	bNum, bIsNumber := toFloat64(b)
+	if aIsNumber && bIsNumber {
+		return aNum == bNum
+	}
+	return reflect.DeepEqual(a, b)
+}
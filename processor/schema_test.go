@@ -0,0 +1,92 @@
+package processor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestParamsSchema(t *testing.T) {
+	var config processor.Config
+	fsys := processor.NewMemFS()
+	err := fsys.WriteFile("config.hjson", []byte(`
+		ParamsSchema: {
+			service_name: { Type: "string", Required: true, Pattern: "[a-z_]+", Max: 10 }
+			use_postgres: { Type: "bool" }
+			replicas: { Type: "int", Min: 1, Max: 5 }
+			log_level: { Type: "string", Enum: ["debug", "info"] }
+			greeting: { Type: "string", Max: 5 }
+			owner: {
+				Type: "object"
+				Properties: {
+					team: { Type: "string", Required: true }
+				}
+			}
+			ports: { Type: "list", Items: { Type: "int" } }
+		}
+		`), 0644)
+	require.NoError(t, err)
+
+	loader := processor.MakeFileLoader(fsys, ".", ".")
+	err = loader.LoadFile("config.hjson", &config)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		params         string
+		expectedErrors []string
+	}{
+		{
+			`
+			service_name: rss_reader
+			use_postgres: true
+			replicas: 3
+			log_level: info
+			greeting: héllo
+			owner: { team: "feeds" }
+			ports: [8080, 8081]
+			`,
+			nil,
+		},
+		{
+			`
+			service_name: RSS-reader-service
+			use_postgres: "yes"
+			replicas: 2.5
+			log_level: trace
+			owner: {}
+			ports: [8080, "http"]
+			`,
+			[]string{
+				`param log_level: value trace is not one of [debug info]`,
+				`param owner.team: required but not defined`,
+				`param ports[1]: expected type int, got string "http"`,
+				`param replicas: expected type int, got 2.5`,
+				`param service_name: value "RSS-reader-service" does not match pattern "[a-z_]+"`,
+				`param service_name: length 18 is greater than the maximum 10`,
+				`param use_postgres: expected type bool, got string "yes"`,
+			},
+		},
+		{
+			`
+			replicas: 0
+			`,
+			[]string{
+				`param replicas: value 0 is less than the minimum 1`,
+				`param service_name: required but not defined`,
+			},
+		},
+	}
+
+	for testI, testCase := range testCases {
+		var params processor.Params
+		err := loader.DeserializeBytes("params.hjson", []byte(testCase.params), &params)
+		require.NoError(t, err)
+
+		var errStrs []string
+		for _, err := range config.ParamsSchema.Validate(params) {
+			errStrs = append(errStrs, err.Error())
+		}
+		require.Equal(t, testCase.expectedErrors, errStrs, "Test case %d", testI)
+	}
+}
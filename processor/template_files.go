@@ -0,0 +1,33 @@
+package processor
+
+import (
+	"strings"
+	"sync"
+)
+
+// templateFiles holds the body of each parsed template, by name, for the
+// loaders of the template engines. It's safe for concurrent use, so that
+// templates can be executed in parallel. See Render.
+type templateFiles struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func newTemplateFiles() *templateFiles {
+	return &templateFiles{files: map[string][]byte{}}
+}
+
+// add stores the body of a template. Names are rooted or not, as the engine
+// refers to them, so any leading "/" is dropped.
+func (tf *templateFiles) add(name string, contents []byte) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	tf.files[strings.TrimPrefix(name, "/")] = contents
+}
+
+func (tf *templateFiles) get(name string) ([]byte, bool) {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+	contents, hasName := tf.files[strings.TrimPrefix(name, "/")]
+	return contents, hasName
+}
@@ -5,6 +5,8 @@ import (
 	"strings"
 )
 
+// TemplateFuncs returns the functions available to templates in every engine.
+// Mustache templates get those which transform a string as lambdas.
 func TemplateFuncs() map[string]any {
 	return map[string]any{
 		"HumanToSnakeCase": func(s string) string {
@@ -18,5 +20,34 @@ func TemplateFuncs() map[string]any {
 			return s
 		},
 		"Sprintf": fmt.Sprintf,
+
+		"CamelCase":          CamelCase,
+		"PascalCase":         PascalCase,
+		"SnakeCase":          SnakeCase,
+		"ScreamingSnakeCase": ScreamingSnakeCase,
+		"KebabCase":          KebabCase,
+		"DotCase":            DotCase,
+		"TitleCase":          TitleCase,
+		"Pluralize":          Pluralize,
+		"Singularize":        Singularize,
+		"GoIdentifier":       GoIdentifier,
+		"JavaIdentifier":     JavaIdentifier,
+		"PythonIdentifier":   PythonIdentifier,
+
+		"Dict":     NamedArgs,
+		"List":     List,
+		"Join":     Join,
+		"Split":    Split,
+		"Contains": Contains,
+		"Keys":     Keys,
+		"SortBy":   SortBy,
+		"Uniq":     Uniq,
+		"Default":  Default,
+		"Coalesce": Coalesce,
+		"Ternary":  Ternary,
+		"ToJSON":   ToJSON,
+		"ToYAML":   ToYAML,
+		"Indent":   Indent,
+		"Nindent":  Nindent,
 	}
 }
@@ -1,10 +1,15 @@
 package processor
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"slices"
+	"strings"
 	"text/template"
+	"text/template/parse"
 )
 
 func GoTemplateMgr() TemplateMgr {
@@ -59,3 +64,87 @@ func NamedArgs(values ...interface{}) (map[string]interface{}, error) {
 	}
 	return dict, nil
 }
+
+// FindParamRefs finds the params referred to by the template tmplName, and any
+// templates it defines, by walking their parse trees. Fields of the dot are
+// params, except inside range and with blocks, where the dot is something
+// else. A defined template may be executed with any dot, so its references
+// are uncertain.
+func (tm *goTemplateMgr) FindParamRefs(tmplName string) ([]ParamRef, error) {
+	var refs []ParamRef
+	for _, tmpl := range tm.tmpl.Templates() {
+		tree := tmpl.Tree
+		if tree == nil || tree.ParseName != tmplName {
+			continue
+		}
+		walker := goParamRefWalker{tree: tree, uncertain: tmpl.Name() != tmplName}
+		walker.walk(tree.Root, true)
+		refs = append(refs, walker.refs...)
+	}
+	slices.SortStableFunc(refs, func(a ParamRef, b ParamRef) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+	return refs, nil
+}
+
+type goParamRefWalker struct {
+	tree      *parse.Tree
+	uncertain bool
+	refs      []ParamRef
+}
+
+// walk adds the param references beneath node. dotIsParams is false inside a
+// range or with block.
+func (w *goParamRefWalker) walk(node parse.Node, dotIsParams bool) {
+	if reflect.ValueOf(node).IsNil() {
+		return
+	}
+	switch node := node.(type) {
+	case *parse.ListNode:
+		for _, child := range node.Nodes {
+			w.walk(child, dotIsParams)
+		}
+	case *parse.ActionNode:
+		w.walk(node.Pipe, dotIsParams)
+	case *parse.PipeNode:
+		for _, cmd := range node.Cmds {
+			w.walk(cmd, dotIsParams)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			w.walk(arg, dotIsParams)
+		}
+	case *parse.ChainNode:
+		w.walk(node.Node, dotIsParams)
+	case *parse.FieldNode:
+		if dotIsParams {
+			w.add(node, node.Ident[0])
+		}
+	case *parse.VariableNode:
+		if node.Ident[0] == "$" && len(node.Ident) > 1 {
+			w.add(node, node.Ident[1])
+		}
+	case *parse.IfNode:
+		w.walk(node.Pipe, dotIsParams)
+		w.walk(node.List, dotIsParams)
+		w.walk(node.ElseList, dotIsParams)
+	case *parse.RangeNode:
+		w.walk(node.Pipe, dotIsParams)
+		w.walk(node.List, false)
+		w.walk(node.ElseList, dotIsParams)
+	case *parse.WithNode:
+		w.walk(node.Pipe, dotIsParams)
+		w.walk(node.List, false)
+		w.walk(node.ElseList, dotIsParams)
+	case *parse.TemplateNode:
+		w.walk(node.Pipe, dotIsParams)
+	}
+}
+
+func (w *goParamRefWalker) add(node parse.Node, name string) {
+	// The location is "name:line:column".
+	location, _ := w.tree.ErrorContext(node)
+	var line int
+	fmt.Sscanf(strings.TrimPrefix(location, w.tree.ParseName+":"), "%d", &line)
+	w.refs = append(w.refs, ParamRef{name, line, w.uncertain})
+}
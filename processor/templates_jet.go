@@ -4,16 +4,17 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"strings"
+	"reflect"
 
 	"github.com/CloudyKit/jet/v6"
 )
 
-type jetCustomLoader map[string][]byte
+type jetCustomLoader struct {
+	*templateFiles
+}
 
 func (cl jetCustomLoader) Open(name string) (io.ReadCloser, error) {
-	name = strings.TrimPrefix(name, "/")
-	contents, hasName := cl[name]
+	contents, hasName := cl.get(name)
 	if !hasName {
 		return nil, fmt.Errorf("unrecognized template name %q", name)
 	}
@@ -21,18 +22,14 @@ func (cl jetCustomLoader) Open(name string) (io.ReadCloser, error) {
 }
 
 func (cl jetCustomLoader) Exists(name string) bool {
-	name = strings.TrimPrefix(name, "/")
-	_, hasName := cl[name]
+	_, hasName := cl.get(name)
 	return hasName
 }
 
-func (cl jetCustomLoader) add(name string, contents []byte) {
-	name = strings.TrimPrefix(name, "/")
-	cl[name] = contents
-}
-
 func JetTemplateMgr() TemplateMgr {
-	loader := jetCustomLoader{}
+	// The Set caches parsed templates in a sync.Map, so it's safe to execute
+	// templates in parallel.
+	loader := jetCustomLoader{newTemplateFiles()}
 	set := jet.NewSet(
 		loader,
 		jet.WithSafeWriter(nil),
@@ -40,7 +37,7 @@ func JetTemplateMgr() TemplateMgr {
 
 	templateFuncs := TemplateFuncs()
 	for name, fn := range templateFuncs {
-		set.AddGlobal(name, fn)
+		set.AddGlobal(name, jetFunc(fn))
 	}
 
 	return &jetTemplateMgr{
@@ -67,3 +64,159 @@ func (tm *jetTemplateMgr) Execute(tmplName string, tmplData any, output io.Write
 
 	return tmpl.Execute(output, nil, tmplData)
 }
+
+// jetFunc adapts a function which returns a value and an error, like the
+// other engines accept, for Jet. Jet ignores every return value but the first,
+// but turns a panic with an error into an error from Execute.
+func jetFunc(fn any) any {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if fnType.Kind() != reflect.Func || fnType.NumOut() != 2 || fnType.Out(1) != errorType {
+		return fn
+	}
+
+	ins := make([]reflect.Type, fnType.NumIn())
+	for i := range ins {
+		ins[i] = fnType.In(i)
+	}
+	wrappedType := reflect.FuncOf(ins, []reflect.Type{fnType.Out(0)}, fnType.IsVariadic())
+	return reflect.MakeFunc(wrappedType, func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		if fnType.IsVariadic() {
+			results = fnValue.CallSlice(args)
+		} else {
+			results = fnValue.Call(args)
+		}
+		if !results[1].IsNil() {
+			panic(results[1].Interface().(error))
+		}
+		return results[:1]
+	}).Interface()
+}
+
+// FindParamRefs parses the template tmplName, and any templates it includes or
+// extends, then finds the params it refers to by walking its parse tree.
+// Fields of the dot are params, except inside a range which doesn't declare a
+// value variable, where the dot is each element. A block may be yielded with
+// any dot, so references inside blocks are uncertain.
+func (tm *jetTemplateMgr) FindParamRefs(tmplName string) ([]ParamRef, error) {
+	tmpl, err := tm.set.GetTemplate(tmplName)
+	if err != nil {
+		return nil, err
+	}
+	var walker jetParamRefWalker
+	walker.walk(tmpl.Root, jetDotParams)
+	return walker.refs, nil
+}
+
+// jetDot is what the dot is, at a point in a Jet template.
+type jetDot int
+
+const (
+	jetDotParams jetDot = iota
+	jetDotUnknown
+	jetDotOther
+)
+
+type jetParamRefWalker struct {
+	refs []ParamRef
+}
+
+// walk adds the param references beneath node.
+func (w *jetParamRefWalker) walk(node jet.Node, dot jetDot) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	walkAll := func(nodes ...jet.Expression) {
+		for _, child := range nodes {
+			w.walk(child, dot)
+		}
+	}
+	switch node := node.(type) {
+	case *jet.ListNode:
+		for _, child := range node.Nodes {
+			w.walk(child, dot)
+		}
+	case *jet.ActionNode:
+		w.walk(node.Set, dot)
+		w.walk(node.Pipe, dot)
+	case *jet.SetNode:
+		walkAll(node.Right...)
+	case *jet.PipeNode:
+		for _, cmd := range node.Cmds {
+			w.walk(cmd, dot)
+		}
+	case *jet.CommandNode:
+		w.walk(node.BaseExpr, dot)
+		walkAll(node.Exprs...)
+	case *jet.CallExprNode:
+		w.walk(node.BaseExpr, dot)
+		walkAll(node.Exprs...)
+	case *jet.ChainNode:
+		w.walk(node.Node, dot)
+	case *jet.FieldNode:
+		if dot != jetDotOther {
+			w.refs = append(w.refs, ParamRef{node.Ident[0], node.Line, dot == jetDotUnknown})
+		}
+	case *jet.IfNode:
+		w.walk(node.Set, dot)
+		walkAll(node.Expression)
+		w.walk(node.List, dot)
+		w.walk(node.ElseList, dot)
+	case *jet.RangeNode:
+		w.walk(node.Set, dot)
+		walkAll(node.Expression)
+		if node.Set == nil || len(node.Set.Left) < 2 {
+			w.walk(node.List, jetDotOther)
+		} else {
+			w.walk(node.List, dot)
+		}
+		w.walk(node.ElseList, dot)
+	case *jet.TryNode:
+		w.walk(node.List, dot)
+		if node.Catch != nil {
+			w.walk(node.Catch.List, dot)
+		}
+	case *jet.BlockNode:
+		w.walkParameters(node.Parameters, dot)
+		walkAll(node.Expression)
+		w.walk(node.List, max(dot, jetDotUnknown))
+		w.walk(node.Content, dot)
+	case *jet.YieldNode:
+		w.walkParameters(node.Parameters, dot)
+		walkAll(node.Expression)
+		w.walk(node.Content, dot)
+	case *jet.IncludeNode:
+		walkAll(node.Name, node.Context)
+	case *jet.ReturnNode:
+		walkAll(node.Value)
+	case *jet.AdditiveExprNode:
+		walkAll(node.Left, node.Right)
+	case *jet.MultiplicativeExprNode:
+		walkAll(node.Left, node.Right)
+	case *jet.ComparativeExprNode:
+		walkAll(node.Left, node.Right)
+	case *jet.NumericComparativeExprNode:
+		walkAll(node.Left, node.Right)
+	case *jet.LogicalExprNode:
+		walkAll(node.Left, node.Right)
+	case *jet.NotExprNode:
+		walkAll(node.Expr)
+	case *jet.TernaryExprNode:
+		walkAll(node.Boolean, node.Left, node.Right)
+	case *jet.IndexExprNode:
+		walkAll(node.Base, node.Index)
+	case *jet.SliceExprNode:
+		walkAll(node.Base, node.Index, node.EndIndex)
+	}
+}
+
+func (w *jetParamRefWalker) walkParameters(parameters *jet.BlockParameterList, dot jetDot) {
+	if parameters == nil {
+		return
+	}
+	for _, parameter := range parameters.List {
+		w.walk(parameter.Expression, dot)
+	}
+}
@@ -0,0 +1,227 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/cbroglie/mustache"
+)
+
+type mustacheCustomLoader struct {
+	*templateFiles
+}
+
+// Get resolves a partial, e.g. {{> partials/header.mustache }}, by its path
+// in the template tree. The ".mustache" extension may be omitted.
+func (cl mustacheCustomLoader) Get(name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+	for _, candidate := range []string{name, name + ".mustache"} {
+		contents, hasName := cl.get(candidate)
+		if hasName {
+			return string(contents), nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized partial name %q", name)
+}
+
+func MustacheTemplateMgr() TemplateMgr {
+	// Mustache has no function calls, only lambdas, which receive the
+	// unrendered text of a section. Expose each of the shared string
+	// functions as a lambda which renders its section, then transforms it,
+	// e.g. {{#HumanToSnakeCase}}{{ project_name }}{{/HumanToSnakeCase}}.
+	helpers := map[string]any{}
+	for name, fn := range TemplateFuncs() {
+		lambda, isStringFunc := mustacheLambda(fn)
+		if isStringFunc {
+			helpers[name] = lambda
+		}
+	}
+
+	return &mustacheTemplateMgr{
+		mustacheCustomLoader{newTemplateFiles()},
+		helpers,
+	}
+}
+
+type mustacheTemplateMgr struct {
+	loader  mustacheCustomLoader
+	helpers map[string]any
+}
+
+func (tm *mustacheTemplateMgr) ParseOne(tmplName string, tmplBody []byte) error {
+	tm.loader.add(tmplName, tmplBody)
+	return nil
+}
+
+func (tm *mustacheTemplateMgr) Execute(tmplName string, tmplData any, output io.Writer) error {
+	tmplBody, err := tm.loader.Get(tmplName)
+	if err != nil {
+		panic(fmt.Sprintf("error retrieving template %q: %s", tmplName, err.Error()))
+	}
+
+	tmpl, err := mustache.ParseStringPartialsRaw(tmplBody, tm.loader, true)
+	if err != nil {
+		return fmt.Errorf("error parsing template %q: %s", tmplName, err.Error())
+	}
+
+	// Like the other engines, referencing an undefined param is an error.
+	// The library's own check is a global setting, shared with any other
+	// user of the library, so check the template's tags before rendering
+	// instead.
+	err = tm.checkVariables(tmpl.Tags(), tmplData, map[string]bool{})
+	if err != nil {
+		return err
+	}
+
+	// Names are looked up in the params first, then in the helpers.
+	return tmpl.FRender(output, tmplData, tm.helpers)
+}
+
+// checkVariables returns an error for the first variable in tags which is
+// neither a param nor a helper. Within a param's section, a name may instead
+// be a field of the section's value, so only the variables outside those
+// sections are checked. Partials are checked in place.
+func (tm *mustacheTemplateMgr) checkVariables(tags []mustache.Tag, params any, checked map[string]bool) error {
+	for _, tag := range tags {
+		_, isHelper := tm.helpers[tag.Name()]
+		switch {
+		case tag.Type() == mustache.Variable && !isHelper:
+			if !mustacheIsDefined(params, tag.Name()) {
+				return fmt.Errorf("missing variable %q", tag.Name())
+			}
+
+		case tag.Type() == mustache.Section && isHelper:
+			err := tm.checkVariables(tag.Tags(), params, checked)
+			if err != nil {
+				return err
+			}
+
+		case tag.Type() == mustache.Partial && !checked[tag.Name()]:
+			checked[tag.Name()] = true
+			partialBody, err := tm.loader.Get(tag.Name())
+			if err != nil {
+				return err
+			}
+			partial, err := mustache.ParseStringPartials(partialBody, tm.loader)
+			if err != nil {
+				return err
+			}
+			err = tm.checkVariables(partial.Tags(), params, checked)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mustacheIsDefined reports whether a name, e.g. "name" or "db.host", is
+// defined in params. Only maps are followed.
+func mustacheIsDefined(params any, name string) bool {
+	if name == "." {
+		return true
+	}
+	value := params
+	for _, key := range strings.Split(name, ".") {
+		var fields map[string]any
+		switch typed := value.(type) {
+		case Params:
+			fields = typed
+		case map[string]any:
+			fields = typed
+		default:
+			return false
+		}
+		var isDefined bool
+		value, isDefined = fields[key]
+		if !isDefined {
+			return false
+		}
+	}
+	return true
+}
+
+// mustacheLambda wraps fn as a mustache lambda, if fn takes a single string
+// and returns a string, optionally with an error.
+func mustacheLambda(fn any) (mustache.LambdaFunc, bool) {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	stringType := reflect.TypeOf("")
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+
+	if fnType.Kind() != reflect.Func || fnType.IsVariadic() ||
+		fnType.NumIn() != 1 || fnType.In(0) != stringType ||
+		fnType.NumOut() < 1 || fnType.NumOut() > 2 || fnType.Out(0) != stringType ||
+		(fnType.NumOut() == 2 && fnType.Out(1) != errorType) {
+		return nil, false
+	}
+
+	return func(text string, render mustache.RenderFunc) (string, error) {
+		rendered, err := render(text)
+		if err != nil {
+			return "", err
+		}
+		results := fnValue.Call([]reflect.Value{reflect.ValueOf(rendered)})
+		if len(results) == 2 && !results[1].IsNil() {
+			return "", results[1].Interface().(error)
+		}
+		return results[0].String(), nil
+	}, true
+}
+
+// FindParamRefs parses the template tmplName, then finds the params it refers
+// to in its tags. Within a section, a name may be a field of the section's
+// value, or else a param, so references inside sections are uncertain.
+// Inverted sections, and sections which call helpers, don't change the
+// context.
+func (tm *mustacheTemplateMgr) FindParamRefs(tmplName string) ([]ParamRef, error) {
+	tmplBody, err := tm.loader.Get(tmplName)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := mustache.ParseStringPartialsRaw(tmplBody, tm.loader, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tags don't record their lines, so find each one in the template by
+	// its name, in order.
+	var refs []ParamRef
+	offset := 0
+	var findRefs func(tags []mustache.Tag, inSection bool)
+	findRefs = func(tags []mustache.Tag, inSection bool) {
+		for _, tag := range tags {
+			if tag.Type() == mustache.Partial {
+				continue
+			}
+			start, end := mustacheTagName(tmplBody, offset, "", tag.Name())
+			offset = end
+			_, isHelper := tm.helpers[tag.Name()]
+			name, _, _ := strings.Cut(tag.Name(), ".")
+			if name != "" && !isHelper {
+				refs = append(refs, ParamRef{name, lineAt([]byte(tmplBody), start), inSection})
+			}
+			if tag.Type() != mustache.Variable {
+				findRefs(tag.Tags(), inSection || tag.Type() == mustache.Section && !isHelper)
+				_, offset = mustacheTagName(tmplBody, offset, "/", tag.Name())
+			}
+		}
+	}
+	findRefs(tmpl.Tags(), false)
+	return refs, nil
+}
+
+// mustacheTagName finds a tag's name in tmplBody, from offset onwards, after
+// some delimiter and the given sigil. It returns the start and end of the
+// name, or offset, offset if there's no such name.
+func mustacheTagName(tmplBody string, offset int, sigil string, name string) (int, int) {
+	pattern := regexp.MustCompile(`[^\w\s]\s*` + regexp.QuoteMeta(sigil) + `\s*(` + regexp.QuoteMeta(name) + `)\s*(?:[^\w\s.]|$)`)
+	loc := pattern.FindStringSubmatchIndex(tmplBody[offset:])
+	if loc == nil {
+		return offset, offset
+	}
+	return offset + loc[2], offset + loc[3]
+}
@@ -0,0 +1,114 @@
+package processor_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cbroglie/mustache"
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+func TestBasicMustache(t *testing.T) {
+	templateMgr := processor.MustacheTemplateMgr()
+
+	tmpl1 := []byte(`
+	1. Constant
+	2. {{ Value }}
+	3. {{ Nested.Value }}
+	4. {{#HumanToSnakeCase}}{{ Name }} & {{ Value }}{{/HumanToSnakeCase}}
+	<div attr="value" />
+	`)
+
+	err := templateMgr.ParseOne("template_1", tmpl1)
+	require.NoError(t, err)
+
+	input := map[string]any{
+		"Value": "abc",
+		"Name":  "Big Potato",
+		"Nested": map[string]any{
+			"Value": 5,
+		},
+	}
+
+	var output bytes.Buffer
+	err = templateMgr.Execute("template_1", input, &output)
+	require.NoError(t, err)
+
+	require.Equal(t, `
+	1. Constant
+	2. abc
+	3. 5
+	4. big_potato_&_abc
+	<div attr="value" />
+	`,
+		output.String())
+}
+
+func TestMultifileMustache(t *testing.T) {
+	templateMgr := processor.MustacheTemplateMgr()
+
+	// The library parses partials in HTML escaping mode.
+	tmpl1 := []byte(`HEADER {{& Title }} {{ Title }}
+`)
+
+	tmpl2 := []byte(`{{> partials/header }}
+CONTENT
+`)
+
+	err := templateMgr.ParseOne("partials/header.mustache", tmpl1)
+	require.NoError(t, err)
+
+	err = templateMgr.ParseOne("page.mustache", tmpl2)
+	require.NoError(t, err)
+
+	input := map[string]any{"Title": "Potatoes & Gravy"}
+
+	var output bytes.Buffer
+	err = templateMgr.Execute("page.mustache", input, &output)
+	require.NoError(t, err)
+
+	require.Equal(t, `HEADER Potatoes & Gravy Potatoes &amp; Gravy
+CONTENT
+`,
+		output.String())
+}
+
+func TestMissingKeyMustache(t *testing.T) {
+	templateMgr := processor.MustacheTemplateMgr()
+
+	err := templateMgr.ParseOne("template_1", []byte(`{{ Missing }}`))
+	require.NoError(t, err)
+
+	var output bytes.Buffer
+	err = templateMgr.Execute("template_1", map[string]any{}, &output)
+	require.Error(t, err)
+
+	// The check is made per render, leaving the library's global setting
+	// alone for any other user of it.
+	require.True(t, mustache.AllowMissingVariables)
+
+	// Within a param's section, a name may be a field of the section's
+	// value, so it isn't checked.
+	templateMgr.ParseOne("partial.mustache", []byte(`{{ Item.Missing }}`))
+	templateMgr.ParseOne("sections", []byte(
+		"{{#Items}}{{ Name }} of {{ Owner }}{{ Missing }}{{/Items}}\n"+
+			"{{#Off}}{{ Missing }}{{/Off}}{{^Items}}{{> partial }}{{/Items}}\n"+
+			"{{#HumanToKebabCase}}{{ Owner }}{{/HumanToKebabCase}}\n"))
+	templateMgr.ParseOne("in_lambda", []byte(`{{#HumanToKebabCase}}{{ Missing }}{{/HumanToKebabCase}}`))
+	templateMgr.ParseOne("in_partial", []byte(`{{> partial }}`))
+	templateMgr.ParseOne("in_delimiters", []byte(`{{=<% %>=}}<% Owner %><% Missing %>`))
+
+	params := map[string]any{
+		"Items": []any{map[string]any{"Name": "a"}, map[string]any{"Name": "b"}},
+		"Owner": "me",
+		"Off":   false,
+	}
+	output.Reset()
+	require.NoError(t, templateMgr.Execute("sections", params, &output))
+	require.Equal(t, "a of meb of me\n\nme\n", output.String())
+	for _, tmplName := range []string{"in_lambda", "in_partial", "in_delimiters"} {
+		err = templateMgr.Execute(tmplName, processor.Params(params), &output)
+		require.ErrorContains(t, err, "missing variable", tmplName)
+	}
+}
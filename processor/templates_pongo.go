@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"strings"
+	"regexp"
 
 	"github.com/flosch/pongo2/v6"
 )
 
-type pongoCustomLoader map[string][]byte
+type pongoCustomLoader struct {
+	*templateFiles
+}
 
 func (cl pongoCustomLoader) Abs(base string, name string) string {
 	// base seems to be the name of the calling template? We'll just
@@ -20,23 +22,17 @@ func (cl pongoCustomLoader) Abs(base string, name string) string {
 }
 
 func (cl pongoCustomLoader) Get(name string) (io.Reader, error) {
-	name = strings.TrimPrefix(name, "/")
-	contents, hasName := cl[name]
+	contents, hasName := cl.get(name)
 	if !hasName {
 		return nil, fmt.Errorf("unrecognized template name %q", name)
 	}
 	return io.NopCloser(bytes.NewBuffer(contents)), nil
 }
 
-func (cl pongoCustomLoader) add(name string, contents []byte) {
-	name = strings.TrimPrefix(name, "/")
-	cl[name] = contents
-}
-
 func PongoTemplateMgr() TemplateMgr {
 	pongo2.SetAutoescape(false)
 
-	loader := pongoCustomLoader{}
+	loader := pongoCustomLoader{newTemplateFiles()}
 	set := pongo2.NewSet("sprout", loader)
 
 	templateFuncs := TemplateFuncs()
@@ -64,10 +60,42 @@ func (tm *pongoTemplateMgr) ParseOne(tmplName string, tmplBody []byte) error {
 }
 
 func (tm *pongoTemplateMgr) Execute(tmplName string, tmplData any, output io.Writer) error {
-	outputStr, err := tm.set.RenderTemplateFile(tmplName, map[string]any{"PARAMS": tmplData})
+	// FromCache, unlike RenderTemplateFile, is safe to call in parallel, and
+	// compiles each template only once.
+	tmpl, err := tm.set.FromCache(tmplName)
+	if err != nil {
+		return err
+	}
+	outputStr, err := tmpl.Execute(map[string]any{"PARAMS": tmplData})
 	if err != nil {
 		return err
 	}
 	_, err = output.Write([]byte(outputStr))
 	return err
 }
+
+// Pongo templates refer to params as PARAMS.name or PARAMS["name"].
+var pongoParamRef = regexp.MustCompile(`\bPARAMS(?:\.([A-Za-z_][A-Za-z0-9_]*)|\[\s*["']([^"']+)["']\s*\])`)
+
+// FindParamRefs compiles the template tmplName, and any templates it includes
+// or extends, then finds the params it refers to. Pongo2 doesn't expose its
+// parse tree, but the params are always referred to through PARAMS, which
+// nothing rebinds.
+func (tm *pongoTemplateMgr) FindParamRefs(tmplName string) ([]ParamRef, error) {
+	_, err := tm.set.FromCache(tmplName)
+	if err != nil {
+		return nil, err
+	}
+	tmplBody, _ := tm.loader.get(tmplName)
+
+	var refs []ParamRef
+	for _, loc := range pongoParamRef.FindAllSubmatchIndex(tmplBody, -1) {
+		nameStart, nameEnd := loc[2], loc[3]
+		if nameStart < 0 {
+			nameStart, nameEnd = loc[4], loc[5]
+		}
+		name := string(tmplBody[nameStart:nameEnd])
+		refs = append(refs, ParamRef{name, lineAt(tmplBody, loc[0]), false})
+	}
+	return refs, nil
+}
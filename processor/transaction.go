@@ -0,0 +1,367 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Transaction is an OutputFS which stages changes to the output directory,
+// so they're applied all at once by Commit, or not at all. Written files are
+// staged in a temporary directory next to the output directory, and removals
+// are only recorded. Reads see the staged changes.
+//
+// Commit moves each staged file into place, and each removed file aside,
+// journaling every step. If a step fails, or the context is cancelled, e.g.
+// by an interrupt signal, the journal is undone, restoring the output
+// directory as it was.
+//
+// Every path must be beneath the output directory.
+type Transaction struct {
+	outputFS   OutputFS
+	outputRoot string
+	stagingDir string
+	staged     map[string]bool
+	removed    map[string]bool
+	logf       Logf
+}
+
+// BeginTransaction creates the staging directory for changes to outputRoot,
+// next to it. If that directory can't be written, e.g. because outputRoot
+// is the user's home directory, or files can't be renamed from it into
+// outputRoot, e.g. because outputRoot is a mount point, the changes are staged
+// in a hidden directory inside outputRoot instead.
+func BeginTransaction(outputFS OutputFS, outputRoot string, logf Logf) (*Transaction, error) {
+	outputRoot = filepath.Clean(outputRoot)
+	stagingName := fmt.Sprintf(".%s.sprout-staging-%d-%d", filepath.Base(outputRoot), os.Getpid(), time.Now().UnixNano())
+	stagingDir := filepath.Join(filepath.Dir(outputRoot), stagingName)
+	innerStagingDir := filepath.Join(outputRoot, stagingName)
+	err := outputFS.MkdirAll(stagingDir, 0700)
+	if err != nil {
+		logf("error creating staging directory %s, staging in the output directory instead: %s", stagingDir, err.Error())
+		stagingDir = innerStagingDir
+		err = outputFS.MkdirAll(stagingDir, 0700)
+	} else if info, statErr := outputFS.Stat(outputRoot); statErr == nil && info.IsDir() {
+		// Commit renames staged files into outputRoot, so check up front that
+		// the staging directory can be, by moving it into outputRoot and back.
+		err = outputFS.Rename(stagingDir, innerStagingDir)
+		if err == nil {
+			err = outputFS.Rename(innerStagingDir, stagingDir)
+			if err != nil {
+				logf("error moving staging directory %s back out of the output directory, staging in the output directory instead: %s", innerStagingDir, err.Error())
+				stagingDir = innerStagingDir
+				err = nil
+			}
+		} else {
+			logf("error moving staging directory %s into the output directory, staging in the output directory instead: %s", stagingDir, err.Error())
+			err = outputFS.Remove(stagingDir)
+			if err == nil {
+				stagingDir = innerStagingDir
+				err = outputFS.MkdirAll(stagingDir, 0700)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating staging directory %s: %s", stagingDir, err.Error())
+	}
+
+	return &Transaction{
+		outputFS:   outputFS,
+		outputRoot: outputRoot,
+		stagingDir: stagingDir,
+		staged:     map[string]bool{},
+		removed:    map[string]bool{},
+		logf:       logf,
+	}, nil
+}
+
+// relPath returns the path of name relative to the output directory.
+func (t *Transaction) relPath(name string) (string, error) {
+	rel, err := filepath.Rel(t.outputRoot, filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s isn't in the output directory %s", name, t.outputRoot)
+	}
+	return rel, nil
+}
+
+// newPath is where the new version of the output file at rel is staged, and
+// oldPath is where Commit moves the old version.
+func (t *Transaction) newPath(rel string) string {
+	return filepath.Join(t.stagingDir, "new", rel)
+}
+
+func (t *Transaction) oldPath(rel string) string {
+	return filepath.Join(t.stagingDir, "old", rel)
+}
+
+// isRemoved reports whether rel, or a directory containing it, is removed.
+func (t *Transaction) isRemoved(rel string) bool {
+	for ; rel != "."; rel = filepath.Dir(rel) {
+		if t.removed[rel] {
+			return true
+		}
+	}
+	return t.removed["."]
+}
+
+func (t *Transaction) ReadFile(name string) ([]byte, error) {
+	rel, err := t.relPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if t.staged[rel] {
+		return t.outputFS.ReadFile(t.newPath(rel))
+	}
+	if t.isRemoved(rel) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return t.outputFS.ReadFile(name)
+}
+
+func (t *Transaction) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	rel, err := t.relPath(name)
+	if err != nil {
+		return err
+	}
+	err = t.outputFS.MkdirAll(filepath.Dir(t.newPath(rel)), 0755)
+	if err != nil {
+		return err
+	}
+	err = t.outputFS.WriteFile(t.newPath(rel), data, perm)
+	if err != nil {
+		return err
+	}
+	t.staged[rel] = true
+	return nil
+}
+
+// MkdirAll only checks that name is in the output directory. The directories
+// of staged files are created by Commit.
+func (t *Transaction) MkdirAll(name string, perm fs.FileMode) error {
+	_, err := t.relPath(name)
+	return err
+}
+
+// Chmod changes the mode of a staged file. A file which isn't staged yet is
+// staged first, unchanged.
+func (t *Transaction) Chmod(name string, mode fs.FileMode) error {
+	rel, err := t.relPath(name)
+	if err != nil {
+		return err
+	}
+	if !t.staged[rel] {
+		content, err := t.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		err = t.WriteFile(name, content, mode)
+		if err != nil {
+			return err
+		}
+	}
+	return t.outputFS.Chmod(t.newPath(rel), mode)
+}
+
+// Remove stages the removal of a file, which must exist, or be staged.
+func (t *Transaction) Remove(name string) error {
+	rel, err := t.relPath(name)
+	if err != nil {
+		return err
+	}
+	wasStaged := t.staged[rel]
+	if wasStaged {
+		delete(t.staged, rel)
+		err = t.outputFS.Remove(t.newPath(rel))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = t.ReadFile(name)
+	if os.IsNotExist(err) && wasStaged {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	t.removed[rel] = true
+	return nil
+}
+
+// RemoveAll stages the removal of a file or directory, and anything staged
+// beneath it.
+func (t *Transaction) RemoveAll(name string) error {
+	rel, err := t.relPath(name)
+	if err != nil {
+		return err
+	}
+	for staged := range t.staged {
+		if rel == "." || staged == rel || strings.HasPrefix(staged, rel+string(filepath.Separator)) {
+			delete(t.staged, staged)
+		}
+	}
+	err = t.outputFS.RemoveAll(t.newPath(rel))
+	if err != nil {
+		return err
+	}
+	t.removed[rel] = true
+	return nil
+}
+
+// Rename isn't supported. Nothing renames output files.
+func (t *Transaction) Rename(oldName string, newName string) error {
+	return fmt.Errorf("renaming %s isn't supported in a transaction", oldName)
+}
+
+func (t *Transaction) Stat(name string) (fs.FileInfo, error) {
+	rel, err := t.relPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if t.staged[rel] {
+		return t.outputFS.Stat(t.newPath(rel))
+	}
+	if t.isRemoved(rel) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return t.outputFS.Stat(name)
+}
+
+// Commit applies the staged changes to the output directory. Removed files
+// are moved aside, and any directories they leave empty are removed, then
+// staged files are moved into place, replacing any old versions. If any step
+// fails, or ctx is cancelled, every step is undone.
+func (t *Transaction) Commit(ctx context.Context) error {
+	var journal []func() error
+	rollback := func(cause error) error {
+		var undoErrs []error
+		for i := len(journal) - 1; i >= 0; i-- {
+			err := journal[i]()
+			if err != nil {
+				undoErrs = append(undoErrs, err)
+			}
+		}
+		if len(undoErrs) > 0 {
+			return fmt.Errorf("error committing output: %s. rolling back also failed, and the previous output files are in %s: %s", cause.Error(), t.oldPath("."), errors.Join(undoErrs...).Error())
+		}
+		t.Abort()
+		return fmt.Errorf("error committing output, rolled back all changes: %s", cause.Error())
+	}
+
+	// moveAside moves the output file or directory at rel to its old path,
+	// if it exists.
+	moveAside := func(rel string) error {
+		target := filepath.Join(t.outputRoot, rel)
+		_, err := t.outputFS.Stat(target)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err == nil {
+			err = t.outputFS.MkdirAll(filepath.Dir(t.oldPath(rel)), 0755)
+		}
+		if err == nil {
+			err = t.outputFS.Rename(target, t.oldPath(rel))
+		}
+		if err != nil {
+			return err
+		}
+		journal = append(journal, func() error {
+			return t.outputFS.Rename(t.oldPath(rel), target)
+		})
+		return nil
+	}
+
+	// Move removed files aside, shallowest first, so a file in a removed
+	// directory moves with the directory.
+	removed := slices.Sorted(maps.Keys(t.removed))
+	for _, rel := range removed {
+		err := ctx.Err()
+		if err == nil && !t.isRemoved(filepath.Dir(rel)) {
+			err = moveAside(rel)
+		}
+		if err != nil {
+			return rollback(err)
+		}
+	}
+
+	for _, rel := range slices.Sorted(maps.Keys(t.staged)) {
+		target := filepath.Join(t.outputRoot, rel)
+		err := ctx.Err()
+		if err == nil {
+			err = moveAside(rel)
+		}
+		if err == nil {
+			err = t.mkdirAll(filepath.Dir(target), &journal)
+		}
+		if err == nil {
+			err = t.outputFS.Rename(t.newPath(rel), target)
+		}
+		if err != nil {
+			return rollback(err)
+		}
+		journal = append(journal, func() error {
+			return t.outputFS.Rename(target, t.newPath(rel))
+		})
+	}
+
+	// Remove the directories which removed files leave empty.
+	for _, rel := range removed {
+		for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+			dirPath := filepath.Join(t.outputRoot, dir)
+			err := t.outputFS.Remove(dirPath)
+			if err != nil {
+				break
+			}
+			journal = append(journal, func() error {
+				return t.outputFS.MkdirAll(dirPath, 0755)
+			})
+		}
+	}
+
+	// A cancellation which arrived during the last step still rolls back.
+	err := ctx.Err()
+	if err != nil {
+		return rollback(err)
+	}
+	t.Abort()
+	return nil
+}
+
+// mkdirAll creates dir and any missing parents, journaling their removal.
+func (t *Transaction) mkdirAll(dir string, journal *[]func() error) error {
+	var missing []string
+	for ; dir != t.outputRoot && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		_, err := t.outputFS.Stat(dir)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		err := t.outputFS.MkdirAll(missing[i], 0755)
+		if err != nil {
+			return err
+		}
+		*journal = append(*journal, func() error {
+			return t.outputFS.Remove(missing[i])
+		})
+	}
+	return nil
+}
+
+// Abort discards the staged changes, and anything Commit moved aside.
+func (t *Transaction) Abort() {
+	err := t.outputFS.RemoveAll(t.stagingDir)
+	if err != nil {
+		t.logf("error removing staging directory %s: %s", t.stagingDir, err.Error())
+	}
+}
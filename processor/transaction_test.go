@@ -0,0 +1,185 @@
+package processor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+)
+
+// readTree returns the contents of every file beneath root.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files[rel] = string(content)
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestTransactionCommit(t *testing.T) {
+	parent := t.TempDir()
+	outputRoot := filepath.Join(parent, "out")
+	writeFiles(t, outputRoot, map[string]string{
+		"a.txt":        "old a",
+		"old/gone.txt": "gone",
+		"keep.txt":     "keep",
+		"base/x.txt":   "old x",
+	})
+	before := readTree(t, outputRoot)
+
+	tx, err := processor.BeginTransaction(processor.DiskFS{}, outputRoot, processor.Printfln)
+	require.NoError(t, err)
+	require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "a.txt"), []byte("new a"), 0644))
+	require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "new/b.txt"), []byte("b"), 0644))
+	require.NoError(t, tx.Chmod(filepath.Join(outputRoot, "new/b.txt"), 0755))
+	require.NoError(t, tx.Remove(filepath.Join(outputRoot, "old/gone.txt")))
+	require.NoError(t, tx.RemoveAll(filepath.Join(outputRoot, "base")))
+	require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "base/y.txt"), []byte("y"), 0644))
+	require.True(t, os.IsNotExist(tx.Remove(filepath.Join(outputRoot, "missing.txt"))))
+	require.ErrorContains(t, tx.WriteFile(filepath.Join(parent, "outside.txt"), nil, 0644), "isn't in the output directory")
+
+	// Reads see the staged changes, but nothing is changed on disk yet.
+	content, err := tx.ReadFile(filepath.Join(outputRoot, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "new a", string(content))
+	_, err = tx.ReadFile(filepath.Join(outputRoot, "base/x.txt"))
+	require.True(t, os.IsNotExist(err))
+	require.Equal(t, before, readTree(t, outputRoot))
+
+	require.NoError(t, tx.Commit(context.Background()))
+	require.Equal(t, map[string]string{
+		"a.txt":      "new a",
+		"keep.txt":   "keep",
+		"new/b.txt":  "b",
+		"base/y.txt": "y",
+	}, readTree(t, outputRoot))
+
+	info, err := os.Stat(filepath.Join(outputRoot, "new/b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode())
+
+	// The emptied directory, and the staging directory, are removed.
+	_, err = os.Stat(filepath.Join(outputRoot, "old"))
+	require.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestTransactionRollback(t *testing.T) {
+	parent := t.TempDir()
+	outputRoot := filepath.Join(parent, "out")
+	writeFiles(t, outputRoot, map[string]string{
+		"a.txt":        "old a",
+		"old/gone.txt": "gone",
+		"z":            "a file, where the new output needs a directory",
+	})
+	before := readTree(t, outputRoot)
+
+	stage := func() *processor.Transaction {
+		tx, err := processor.BeginTransaction(processor.DiskFS{}, outputRoot, processor.Printfln)
+		require.NoError(t, err)
+		require.NoError(t, tx.Remove(filepath.Join(outputRoot, "old/gone.txt")))
+		require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "a.txt"), []byte("new a"), 0644))
+		require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "new/b.txt"), []byte("b"), 0644))
+		require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "z/c.txt"), []byte("c"), 0644))
+		return tx
+	}
+
+	// Installing z/c.txt fails, after the other changes are made.
+	err := stage().Commit(context.Background())
+	require.ErrorContains(t, err, "error committing output, rolled back all changes")
+	require.Equal(t, before, readTree(t, outputRoot))
+	_, err = os.Stat(filepath.Join(outputRoot, "new"))
+	require.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// So does an interrupt.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = stage().Commit(ctx)
+	require.ErrorContains(t, err, context.Canceled.Error())
+	require.Equal(t, before, readTree(t, outputRoot))
+}
+
+// crossDeviceFS fails renames into or out of root, as if root were a mount
+// point.
+type crossDeviceFS struct {
+	processor.DiskFS
+	root string
+}
+
+func (c crossDeviceFS) Rename(oldName string, newName string) error {
+	isBeneath := func(name string) bool {
+		return strings.HasPrefix(name, c.root+string(filepath.Separator))
+	}
+	if isBeneath(oldName) != isBeneath(newName) {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: syscall.EXDEV}
+	}
+	return c.DiskFS.Rename(oldName, newName)
+}
+
+func TestTransactionCrossDevice(t *testing.T) {
+	parent := t.TempDir()
+	outputRoot := filepath.Join(parent, "out")
+	writeFiles(t, outputRoot, map[string]string{
+		"a.txt":    "old a",
+		"gone.txt": "gone",
+	})
+
+	tx, err := processor.BeginTransaction(crossDeviceFS{root: outputRoot}, outputRoot, processor.Printfln)
+	require.NoError(t, err)
+	require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "a.txt"), []byte("new a"), 0644))
+	require.NoError(t, tx.WriteFile(filepath.Join(outputRoot, "new/b.txt"), []byte("b"), 0644))
+	require.NoError(t, tx.Remove(filepath.Join(outputRoot, "gone.txt")))
+	require.NoError(t, tx.Commit(context.Background()))
+	require.Equal(t, map[string]string{
+		"a.txt":     "new a",
+		"new/b.txt": "b",
+	}, readTree(t, outputRoot))
+
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestTransactionInMemory(t *testing.T) {
+	outputFS := processor.NewMemOutputFS()
+	require.NoError(t, outputFS.WriteFile("/output/a/old.txt", []byte("old"), 0644))
+
+	tx, err := processor.BeginTransaction(outputFS, "/output", processor.Printfln)
+	require.NoError(t, err)
+	require.NoError(t, tx.Remove("/output/a/old.txt"))
+	require.NoError(t, tx.WriteFile("/output/b/new.txt", []byte("new"), 0644))
+	require.NoError(t, tx.Commit(context.Background()))
+
+	_, err = outputFS.ReadFile("/output/a/old.txt")
+	require.True(t, os.IsNotExist(err))
+	_, err = outputFS.Stat("/output/a")
+	require.True(t, os.IsNotExist(err))
+	content, err := outputFS.ReadFile("/output/b/new.txt")
+	require.NoError(t, err)
+	require.Equal(t, "new", string(content))
+
+	entries, err := outputFS.Files.ReadDir(".")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
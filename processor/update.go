@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BaseRenderDir returns the directory where a copy of each output file is
+// kept, exactly as sprout generated it, next to the digest file. In update
+// mode, this copy is the base of the three-way merge between the user's
+// current files and the new output.
+func BaseRenderDir(absDigestPath string) string {
+	return strings.TrimSuffix(absDigestPath, filepath.Ext(absDigestPath)) + ".base"
+}
+
+// MatchesBaseRender reports whether the output file at relPath is unchanged
+// since sprout generated it.
+func MatchesBaseRender(
+	outputRoot string,
+	baseRenderDir string,
+	relPath string,
+	readFileFn func(string) ([]byte, error),
+) bool {
+	current, err := readFileFn(filepath.Join(outputRoot, relPath))
+	if err != nil {
+		return false
+	}
+	base, err := readFileFn(filepath.Join(baseRenderDir, relPath))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(current, base)
+}
+
+// mergeWithCurrent merges newly generated content into the existing output
+// file at outputPath, if any, using the previous base render as the common
+// ancestor. If there's no previous base render, the whole file is treated as
+// a single conflict, unless the user's file already matches.
+func mergeWithCurrent(
+	outputRoot string,
+	baseRenderDir string,
+	outputPath string,
+	generated []byte,
+	readFileFn func(string) ([]byte, error),
+) ([]byte, int, error) {
+	current, err := readFileFn(outputPath)
+	if os.IsNotExist(err) {
+		return generated, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	relPath := SafeCutPrefix(outputPath, outputRoot)
+	base, err := readFileFn(filepath.Join(baseRenderDir, relPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, err
+	}
+
+	merged, conflicts := Merge3(base, current, generated)
+	return merged, conflicts, nil
+}
@@ -5,19 +5,21 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
-func FindFiles(fileRoot string) []string {
+// FindFiles returns the path of every file beneath fileRoot in fsys, skipping
+// dotfiles.
+func FindFiles(fsys fs.FS, fileRoot string) ([]string, error) {
 	var files []string
-	filepath.WalkDir(fileRoot, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(fsys, fileRoot, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			fmt.Println(err.Error())
+			return err
 		}
 		baseName := filepath.Base(path)
-		if baseName[0] == '.' {
-			Printfln("skipping dotfile %s", path)
+		if path != fileRoot && baseName[0] == '.' {
 			return nil
 		}
 		if !d.IsDir() {
@@ -26,14 +28,14 @@ func FindFiles(fileRoot string) []string {
 		return nil
 	})
 
-	return files
+	return files, err
 }
 
-func FindFilesWithName(fileRoot string, targetName string) []string {
+func FindFilesWithName(fsys fs.FS, fileRoot string, targetName string) ([]string, error) {
 	var files []string
-	filepath.WalkDir(fileRoot, func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(fsys, fileRoot, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			fmt.Println(err.Error())
+			return err
 		}
 		baseName := filepath.Base(path)
 		if baseName == targetName {
@@ -42,9 +44,13 @@ func FindFilesWithName(fileRoot string, targetName string) []string {
 		return nil
 	})
 
-	return files
+	return files, err
 }
 
+// Logf reports the progress of sprout, one line per call. Printfln is the
+// Logf of the command line tool.
+type Logf func(format string, args ...any)
+
 func Printfln(format string, args ...any) {
 	fmt.Printf(format+"\n", args...)
 }
@@ -119,3 +125,41 @@ func ScrubPath(path string) string {
 	}
 	return filepath.Clean(absPath)
 }
+
+// MatchGlob reports whether a slash-separated path matches pattern. Each path
+// segment is matched as in path.Match, except that a "**" segment matches
+// any number of segments, including none. A pattern without any wildcards
+// that names a directory also matches everything beneath that directory.
+func MatchGlob(pattern string, name string) bool {
+	patternParts := strings.Split(path.Clean(pattern), "/")
+	nameParts := strings.Split(path.Clean(name), "/")
+	if matchGlobParts(patternParts, nameParts) {
+		return true
+	}
+	hasWildcards := strings.ContainsAny(pattern, `*?[\`)
+	return !hasWildcards && matchGlobParts(append(patternParts, "**"), nameParts)
+}
+
+func matchGlobParts(patternParts []string, nameParts []string) bool {
+	if len(patternParts) == 0 {
+		return len(nameParts) == 0
+	}
+
+	if patternParts[0] == "**" {
+		for i := 0; i <= len(nameParts); i++ {
+			if matchGlobParts(patternParts[1:], nameParts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(nameParts) == 0 {
+		return false
+	}
+	isMatch, err := path.Match(patternParts[0], nameParts[0])
+	if err != nil || !isMatch {
+		return false
+	}
+	return matchGlobParts(patternParts[1:], nameParts[1:])
+}
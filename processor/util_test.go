@@ -38,3 +38,38 @@ func TestSafeCutPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern       string
+		name          string
+		expectedMatch bool
+	}{
+		{"main.go", "main.go", true},
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "cmd/main.go", true},
+		{"**/*.go", "main.go", true},
+		{"db/**", "db/schema.sql", true},
+		{"db/**", "db/migrations/001.sql", true},
+		{"db/**", "dbx/schema.sql", false},
+		{"db", "db/migrations/001.sql", true},
+		{"db", "db", true},
+		{"scripts/*.sh", "scripts/build.sh", true},
+		{"scripts/*.sh", "scripts/sub/build.sh", false},
+		{"cmd/**/main.go", "cmd/main.go", true},
+		{"cmd/**/main.go", "cmd/a/b/main.go", true},
+		// Only a pattern without wildcards matches beneath a directory.
+		{"*.go", "foo.go/bar", false},
+		{"src/*", "src/a", true},
+		{"src/*", "src/a/b", false},
+		{"src/a?", "src/ab/c", false},
+		{"src/[ab]", "src/a/c", false},
+		{"src/a", "src/a/b/c", true},
+	}
+
+	for _, testCase := range testCases {
+		isMatch := processor.MatchGlob(testCase.pattern, testCase.name)
+		require.Equal(t, testCase.expectedMatch, isMatch, "%q ~ %q", testCase.pattern, testCase.name)
+	}
+}
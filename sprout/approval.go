@@ -0,0 +1,219 @@
+package sprout
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/treaster/sprout/processor"
+)
+
+// CommandPolicy says whether a Generator runs the commands of a template,
+// i.e. its post-processor scripts and hooks.
+type CommandPolicy string
+
+const (
+	// CommandsManual runs nothing. The commands are reported, for the user to
+	// examine and run by hand.
+	CommandsManual CommandPolicy = "manual"
+	// CommandsAuto runs every command, unrestricted.
+	CommandsAuto CommandPolicy = "auto"
+	// CommandsAllowlist runs the commands once the user has approved them, in
+	// a sandbox whose PATH only contains the commands declared by the
+	// template. See processor.Sandbox. The approval is remembered, until the commands or the
+	// contents of the post-processor scripts change.
+	CommandsAllowlist CommandPolicy = "allowlist"
+)
+
+// ParseCommandPolicy validates a policy name given on the command line.
+func ParseCommandPolicy(s string) (CommandPolicy, error) {
+	policy := CommandPolicy(s)
+	switch policy {
+	case CommandsManual, CommandsAuto, CommandsAllowlist:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unrecognized policy %q for post-processors and hooks. expected %s, %s or %s", s, CommandsManual, CommandsAuto, CommandsAllowlist)
+}
+
+// Approval records what the user approved for a template to run.
+type Approval struct {
+	// Commands are the commands declared by the template.
+	Commands []string
+	// Scripts maps the path of each post-processor script, relative to the
+	// output directory, to the SHA256 of its contents.
+	Scripts map[string]string
+	// HooksSHA256 is the SHA256 of the template's hooks, as JSON.
+	HooksSHA256 string
+}
+
+// digest returns the SHA256 of the approval, which identifies what was
+// approved wherever the template is.
+func (a Approval) digest() (string, error) {
+	approvalBytes, err := json.Marshal(a)
+	if err != nil {
+		return "", fmt.Errorf("error hashing approval: %s", err.Error())
+	}
+	return processor.HashBytes(approvalBytes), nil
+}
+
+// approvals is the approvals file. Approvals are kept by their digest, so that
+// an approval follows the template's contents, rather than its path. Latest
+// maps the source of each template's config to the digest of its latest
+// approval, only to tell the user what changed since.
+type approvals struct {
+	Approved map[string]Approval
+	Latest   map[string]string
+}
+
+// ApprovalRequest asks the user to approve what a template will run.
+type ApprovalRequest struct {
+	// Template is the source of the template's config.
+	Template string
+	Approval Approval
+	// Previous is the approval given for an earlier version of the template,
+	// which has changed since, or nil if the template was never approved.
+	Previous *Approval
+	// ScriptContents maps the path of each post-processor script to its
+	// contents, for the user to examine.
+	ScriptContents map[string][]byte
+	Hooks          processor.Hooks
+}
+
+// DefaultApprovalsPath returns where approvals are remembered: in the sprout
+// directory of the user's config directory, or else of DefaultCacheDir().
+func DefaultApprovalsPath() string {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(DefaultCacheDir(), "approvals.json")
+	}
+	return filepath.Join(userConfigDir, "sprout", "approvals.json")
+}
+
+// loadApprovals reads the approvals file. A missing file has no approvals.
+func loadApprovals(approvalsPath string) (approvals, error) {
+	loaded := approvals{}
+	approvalsBytes, err := os.ReadFile(approvalsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return loaded, fmt.Errorf("error reading approvals file: %s", err.Error())
+	}
+	if err == nil {
+		err = json.Unmarshal(approvalsBytes, &loaded)
+		if err != nil {
+			return loaded, fmt.Errorf("error parsing approvals file %s: %s", approvalsPath, err.Error())
+		}
+	}
+	if loaded.Approved == nil {
+		loaded.Approved = map[string]Approval{}
+	}
+	if loaded.Latest == nil {
+		loaded.Latest = map[string]string{}
+	}
+	return loaded, nil
+}
+
+func saveApprovals(approvalsPath string, approvals approvals) error {
+	approvalsBytes, err := json.MarshalIndent(approvals, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(approvalsPath), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(approvalsPath, append(approvalsBytes, '\n'), 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing approvals file: %s", err.Error())
+	}
+	return nil
+}
+
+// approvalRequest returns the approval needed to run the commands of the
+// rendered template.
+func approvalRequest(t *Template, rendered Rendered, outputRoot string) (ApprovalRequest, error) {
+	request := ApprovalRequest{
+		Template: t.Source.Config,
+		Approval: Approval{
+			Commands: rendered.Commands,
+			Scripts:  map[string]string{},
+		},
+		ScriptContents: map[string][]byte{},
+		Hooks:          rendered.Hooks,
+	}
+	for _, script := range rendered.PostProcessorScripts {
+		outputFile, isRendered := rendered.Files[filepath.Join(outputRoot, script)]
+		if !isRendered {
+			return request, fmt.Errorf("post-processor %s isn't generated by the template, so it can't be approved", script)
+		}
+		request.Approval.Scripts[script] = processor.HashBytes(outputFile.Content)
+		request.ScriptContents[script] = outputFile.Content
+	}
+
+	hooksBytes, err := json.Marshal(rendered.Hooks)
+	if err != nil {
+		return request, fmt.Errorf("error hashing hooks: %s", err.Error())
+	}
+	request.Approval.HooksSHA256 = processor.HashBytes(hooksBytes)
+	return request, nil
+}
+
+// approve checks that the user has approved the commands of the rendered
+// template, asking them through Options.Approve if not, and returns the
+// sandbox to run the commands in.
+func (g Generator) approve(t *Template, rendered Rendered, outputRoot string, logf processor.Logf) (*processor.Sandbox, error) {
+	request, err := approvalRequest(t, rendered, outputRoot)
+	if err != nil {
+		return nil, err
+	}
+	sandbox := &processor.Sandbox{
+		Commands:     rendered.Commands,
+		ScriptHashes: request.Approval.Scripts,
+		Isolate:      true,
+	}
+	if len(rendered.PostProcessorScripts) == 0 && len(rendered.Hooks.PreGenerate) == 0 && len(rendered.Hooks.PostGenerate) == 0 {
+		return sandbox, nil
+	}
+
+	approvalsPath := g.Options.ApprovalsPath
+	if approvalsPath == "" {
+		approvalsPath = DefaultApprovalsPath()
+	}
+	approvals, err := loadApprovals(approvalsPath)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := request.Approval.digest()
+	if err != nil {
+		return nil, err
+	}
+	_, isApproved := approvals.Approved[digest]
+	if isApproved {
+		logf("using approval of %s from %s", t.Source.Config, approvalsPath)
+		return sandbox, nil
+	}
+	previous, isApproved := approvals.Approved[approvals.Latest[t.Source.Config]]
+	if isApproved {
+		request.Previous = &previous
+	}
+
+	if g.Options.Approve == nil {
+		if isApproved {
+			return nil, fmt.Errorf("the post-processor or hooks of %s have changed since they were approved, and must be approved again", t.Source.Config)
+		}
+		return nil, fmt.Errorf("the post-processor and hooks of %s must be approved before they're run", t.Source.Config)
+	}
+	isApproved, err = g.Options.Approve(request)
+	if err != nil {
+		return nil, err
+	}
+	if !isApproved {
+		return nil, fmt.Errorf("the post-processor and hooks of %s were not approved", t.Source.Config)
+	}
+
+	approvals.Approved[digest] = request.Approval
+	approvals.Latest[t.Source.Config] = digest
+	err = saveApprovals(approvalsPath, approvals)
+	if err != nil {
+		return nil, err
+	}
+	logf("saved approval of %s to %s", t.Source.Config, approvalsPath)
+	return sandbox, nil
+}
@@ -0,0 +1,96 @@
+package sprout_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
+)
+
+func TestMain(m *testing.M) {
+	// Isolated commands re-execute the test binary.
+	processor.MaybeRunSandboxed()
+	os.Exit(m.Run())
+}
+
+func TestGeneratorAllowlist(t *testing.T) {
+	templateFiles := map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			DirsMapping: { "templates": "." }
+			PostProcessorScript: "post.sh"
+			Commands: [ "sh" ]
+			Hooks: {
+				PostGenerate: [ { Command: "sh", Args: [ "-c", "echo hook" ], Env: { MODE: "{{ .mode }}" } } ]
+			}
+		}`,
+		"templates/post.sh.gotmpl": "#!/bin/sh\necho {{ .greeting }}\n",
+	}
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, templateFiles)
+
+	var requests []sprout.ApprovalRequest
+	generator := sprout.Generator{
+		Source: filepath.Join(inputRoot, "config.hjson"),
+		Params: processor.Params{"greeting": "hello", "mode": "safe"},
+		Output: t.TempDir(),
+		Options: sprout.Options{
+			CommandPolicy: sprout.CommandsAllowlist,
+			ApprovalsPath: filepath.Join(t.TempDir(), "approvals.json"),
+		},
+	}
+
+	_, err := generator.Run(context.Background())
+	require.ErrorContains(t, err, "must be approved before they're run")
+
+	generator.Options.Approve = func(request sprout.ApprovalRequest) (bool, error) {
+		requests = append(requests, request)
+		return len(requests) == 1, nil
+	}
+	result, err := generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", string(result.PostProcessorOutput))
+	require.Equal(t, "hook\n", string(result.Hooks[0].Output))
+	require.Len(t, requests, 1)
+	require.Equal(t, []string{"sh"}, requests[0].Approval.Commands)
+	require.Equal(t, "#!/bin/sh\necho hello\n", string(requests[0].ScriptContents["post.sh"]))
+	require.Nil(t, requests[0].Previous)
+
+	// The approval is remembered.
+	_, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+
+	// A change to the script needs a new approval, which is refused.
+	generator.Params["greeting"] = "goodbye"
+	_, err = generator.Run(context.Background())
+	require.ErrorContains(t, err, "were not approved")
+	require.Len(t, requests, 2)
+	require.NotNil(t, requests[1].Previous)
+
+	generator.Options.Approve = nil
+	_, err = generator.Run(context.Background())
+	require.ErrorContains(t, err, "have changed since they were approved")
+
+	// So does a change to a hook's environment.
+	generator.Params["greeting"] = "hello"
+	_, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	generator.Params["mode"] = "fast"
+	_, err = generator.Run(context.Background())
+	require.ErrorContains(t, err, "have changed since they were approved")
+
+	// The approval follows the template's contents, not its path, so a copy of
+	// the template elsewhere is approved too.
+	generator.Params["mode"] = "safe"
+	movedRoot := t.TempDir()
+	writeFiles(t, movedRoot, templateFiles)
+	generator.Source = filepath.Join(movedRoot, "config.hjson")
+	result, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", string(result.PostProcessorOutput))
+}
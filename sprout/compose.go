@@ -0,0 +1,249 @@
+package sprout
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/treaster/sprout/processor"
+)
+
+// Stack returns every template composed by t, from the lowest precedence to
+// the highest: the template it Extends (and, recursively, its stack), then
+// each of its Layers (and their stacks) in order, then t itself. A template
+// composed more than once, e.g. a base extended by two layers, appears only
+// at its first position.
+func (t *Template) Stack() []*Template {
+	var stack []*Template
+	var add func(member *Template)
+	add = func(member *Template) {
+		if member.Extends != nil {
+			add(member.Extends)
+		}
+		for _, layer := range member.Layers {
+			add(layer)
+		}
+		if !slices.Contains(stack, member) {
+			stack = append(stack, member)
+		}
+	}
+	add(t)
+	return stack
+}
+
+// composes reports whether t extends or layers other, directly or
+// transitively.
+func (t *Template) composes(other *Template) bool {
+	return t != other && slices.Contains(t.Stack(), other)
+}
+
+// ParamsSchema returns the schema of the params of every template in the
+// stack. Where two templates declare the same param, the one with the higher
+// precedence wins.
+func (t *Template) ParamsSchema() processor.ParamsSchema {
+	var schema processor.ParamsSchema
+	for _, member := range t.Stack() {
+		if member.Config.ParamsSchema == nil {
+			continue
+		}
+		if schema == nil {
+			schema = processor.ParamsSchema{}
+		}
+		maps.Copy(schema, member.Config.ParamsSchema)
+	}
+	return schema
+}
+
+// LoadExampleParams returns the example params from the TemplateParamsFile of
+// every template in the stack. Where two files set the same param, the one
+// with the higher precedence wins.
+func (t *Template) LoadExampleParams() (processor.Params, error) {
+	params := processor.Params{}
+	for _, member := range t.Stack() {
+		if member.Config.TemplateParamsFile == "" {
+			continue
+		}
+		var memberParams processor.Params
+		err := member.Loader().LoadFile(member.Config.TemplateParamsFile, &memberParams)
+		if err != nil {
+			return nil, fmt.Errorf("error loading params template of %s: %s", member.Source.Config, err.Error())
+		}
+		maps.Copy(params, memberParams)
+	}
+	return params, nil
+}
+
+// ExampleParams returns the contents of the template's TemplateParamsFile,
+// which demonstrates the params the template expects. If other templates in
+// the stack have params files too, their merged params are returned instead,
+// encoded in the format of the highest precedence params file.
+func (t *Template) ExampleParams() ([]byte, error) {
+	var paramsTemplates []*Template
+	for _, member := range t.Stack() {
+		if member.Config.TemplateParamsFile != "" {
+			paramsTemplates = append(paramsTemplates, member)
+		}
+	}
+	if len(paramsTemplates) <= 1 {
+		return t.Loader().LoadFileAsBytes(t.Config.TemplateParamsFile)
+	}
+
+	params, err := t.LoadExampleParams()
+	if err != nil {
+		return nil, err
+	}
+	top := paramsTemplates[len(paramsTemplates)-1]
+	return top.Loader().SerializeBytes(top.Config.TemplateParamsFile, params)
+}
+
+// Rendered is the output of Template.Render.
+type Rendered struct {
+	// Files are the output files of the whole stack, keyed by their paths in
+	// the output directory.
+	Files map[string]processor.OutputFile
+	// PostProcessorScripts and Hooks are those of every template in the
+	// stack, in order.
+	PostProcessorScripts []string
+	Hooks                processor.Hooks
+	// Commands are the commands declared by every template in the stack,
+	// sorted.
+	Commands []string
+}
+
+// Render resolves the config of every template in the stack, and renders
+// each template with its own engine. Nothing is written.
+//
+// The DirsMapping values, FilesMapping, Conditions and FileModes of the
+// templates are merged, so that a template may rename or exclude the files of
+// the templates it composes. Where two templates map the same key, the one
+// with the higher precedence wins.
+//
+// If two templates generate the same output file, the one with the higher
+// precedence wins, as long as it composes the other. Otherwise, e.g. for two
+// layers of the same template, it's an error, unless a template which
+// composes both also generates the file.
+//
+// Each template's files are executed by up to jobs workers in parallel.
+func (t *Template) Render(outputRoot string, params processor.Params, jobs int, logf processor.Logf) (Rendered, []error) {
+	var errs []error
+	addError := func(s string, args ...any) {
+		errs = append(errs, &Error{Category: ConfigError, Err: fmt.Errorf(s, args...)})
+	}
+
+	stack := t.Stack()
+	configs := make([]processor.Config, len(stack))
+	for i, member := range stack {
+		config, err := member.ResolveConfig(params)
+		if err != nil {
+			errs = append(errs, &Error{
+				Category: ConfigError,
+				File:     member.displayPath(path.Join(member.Root, member.ConfigFile)),
+				Line:     processor.ErrorLine("__config__", err),
+				Err:      fmt.Errorf("error resolving config of %s: %s", member.Source.Config, err.Error()),
+			})
+			continue
+		}
+		configs[i] = config
+	}
+	if len(errs) > 0 {
+		return Rendered{}, errs
+	}
+
+	// Merge each template's mappings with those of the templates above it.
+	for i := range configs {
+		for _, above := range configs[i+1:] {
+			for inputSubdir := range configs[i].DirsMapping {
+				targetSubdir, hasSubdir := above.DirsMapping[inputSubdir]
+				if hasSubdir {
+					configs[i].DirsMapping[inputSubdir] = targetSubdir
+				}
+			}
+			configs[i].FilesMapping = mergeMappings(configs[i].FilesMapping, above.FilesMapping)
+			configs[i].Conditions = mergeMappings(configs[i].Conditions, above.Conditions)
+			configs[i].FileModes = mergeMappings(configs[i].FileModes, above.FileModes)
+		}
+	}
+
+	rendered := Rendered{Files: map[string]processor.OutputFile{}}
+	generatedBy := map[string][]*Template{}
+	for i, member := range stack {
+		templateMgrFactory, err := member.TemplateEngine()
+		if err != nil {
+			addError("%s", err.Error())
+			continue
+		}
+
+		memberContents, memberErrs := processor.Render(
+			templateMgrFactory,
+			member.Root,
+			outputRoot,
+			configs[i],
+			params,
+			jobs,
+			member.FS,
+			logf,
+		)
+		for _, err := range memberErrs {
+			errs = append(errs, member.categorizeRendered(err))
+		}
+
+		// Templates are rendered in order of precedence, so each file
+		// replaces any file at the same path from the templates below.
+		for outputPath, outputFile := range memberContents {
+			rendered.Files[outputPath] = outputFile
+			generatedBy[outputPath] = append(generatedBy[outputPath], member)
+		}
+
+		script := configs[i].PostProcessorScript
+		if script != "" && !slices.Contains(rendered.PostProcessorScripts, script) {
+			rendered.PostProcessorScripts = append(rendered.PostProcessorScripts, script)
+		}
+		rendered.Hooks.PreGenerate = append(rendered.Hooks.PreGenerate, configs[i].Hooks.PreGenerate...)
+		rendered.Hooks.PostGenerate = append(rendered.Hooks.PostGenerate, configs[i].Hooks.PostGenerate...)
+		for _, command := range configs[i].Commands {
+			if !slices.Contains(rendered.Commands, command) {
+				rendered.Commands = append(rendered.Commands, command)
+			}
+		}
+	}
+	slices.Sort(rendered.Commands)
+	errs = append(errs, categorize(ConfigError, processor.ValidateHooks(rendered.Hooks)...)...)
+
+	for _, outputPath := range slices.Sorted(maps.Keys(generatedBy)) {
+		members := generatedBy[outputPath]
+		winner := members[len(members)-1]
+		var conflicting []string
+		for _, member := range members[:len(members)-1] {
+			if !winner.composes(member) {
+				conflicting = append(conflicting, member.Source.Config)
+			}
+		}
+		if len(conflicting) > 0 {
+			addError(
+				"output file %s is generated by both %s and %s, and neither composes the other. generate the file in a template which composes both, to resolve the conflict",
+				filepath.Clean(outputPath), strings.Join(conflicting, ", "), winner.Source.Config)
+		}
+	}
+
+	if len(errs) > 0 {
+		return Rendered{}, errs
+	}
+	return rendered, nil
+}
+
+// mergeMappings returns the entries of lower, replaced or added to by those of
+// higher.
+func mergeMappings(lower map[string]string, higher map[string]string) map[string]string {
+	if len(higher) == 0 {
+		return lower
+	}
+	merged := maps.Clone(lower)
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	maps.Copy(merged, higher)
+	return merged
+}
@@ -0,0 +1,115 @@
+package sprout_test
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
+)
+
+func TestCompose(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"base/config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			TemplateParamsFile: "params.hjson"
+			DirsMapping: { "templates": "." }
+			ParamsSchema: { name: { Type: "string", Required: true } }
+		}`,
+		"base/params.hjson":            `{ name: "base" }`,
+		"base/templates/go.mod.gotmpl": "module {{ .name }}\n",
+		"base/templates/README.md":     "base readme\n",
+		"base/templates/Makefile":      "base makefile\n",
+
+		"docker/config.hjson": `{
+			TemplateTypeExt: ".jet"
+			Extends: "../base/config.hjson"
+			DirsMapping: { "templates": "." }
+		}`,
+		"docker/templates/Dockerfile.jet": "FROM {{ .name }}\n",
+		"docker/templates/Makefile":       "docker makefile\n",
+
+		"ci/config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			TemplateParamsFile: "params.hjson"
+			Extends: "../base/config.hjson"
+			DirsMapping: { "templates": "." }
+			ParamsSchema: { ci: { Type: "string", Default: "github" } }
+		}`,
+		"ci/params.hjson":        `{ ci: "github" }`,
+		"ci/templates/ci.yml":    "ci\n",
+		"ci/templates/README.md": "ci readme\n",
+		"ci/templates/Makefile":  "ci makefile\n",
+
+		"service/config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			Layers: [ "../docker/config.hjson", "../ci/config.hjson" ]
+			DirsMapping: { "templates": "." }
+		}`,
+		"service/templates/Makefile": "service makefile\n",
+		"service/templates/main.go":  "package main\n",
+	})
+
+	template, err := sprout.OpenTemplate(filepath.Join(inputRoot, "service/config.hjson"), t.TempDir())
+	require.NoError(t, err)
+
+	var stack []string
+	for _, member := range template.Stack() {
+		stack = append(stack, filepath.Base(filepath.Dir(member.Source.Config)))
+	}
+	require.Equal(t, []string{"base", "docker", "ci", "service"}, stack)
+	require.Equal(t, []string{"ci", "name"}, slices.Sorted(maps.Keys(template.ParamsSchema())))
+
+	example, err := template.LoadExampleParams()
+	require.NoError(t, err)
+	require.Equal(t, processor.Params{"name": "base", "ci": "github"}, example)
+
+	outputRoot := t.TempDir()
+	result, err := sprout.Generator{
+		Params: processor.Params{"name": "svc"},
+		Output: outputRoot,
+	}.RunTemplate(context.Background(), template)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Dockerfile", "Makefile", "README.md", "ci.yml", "go.mod", "main.go"}, result.Written)
+
+	expected := map[string]string{
+		"Dockerfile": "FROM svc\n",
+		"Makefile":   "service makefile\n",
+		"README.md":  "ci readme\n",
+		"ci.yml":     "ci\n",
+		"go.mod":     "module svc\n",
+		"main.go":    "package main\n",
+	}
+	for path, contents := range expected {
+		actual, err := os.ReadFile(filepath.Join(outputRoot, path))
+		require.NoError(t, err)
+		require.Equal(t, contents, string(actual), path)
+	}
+
+	// Without the service's own Makefile, the two layers conflict.
+	require.NoError(t, os.Remove(filepath.Join(inputRoot, "service/templates/Makefile")))
+	template, err = sprout.OpenTemplate(filepath.Join(inputRoot, "service/config.hjson"), t.TempDir())
+	require.NoError(t, err)
+	_, errs := template.Render(outputRoot, processor.Params{"name": "svc"}, 1, processor.Printfln)
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "output file "+filepath.Join(outputRoot, "Makefile")+" is generated by both")
+	require.ErrorContains(t, errs[0], filepath.Join(inputRoot, "docker/config.hjson"))
+	require.ErrorContains(t, errs[0], filepath.Join(inputRoot, "ci/config.hjson"))
+}
+
+func TestComposeCycle(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"a/config.hjson": `{ TemplateTypeExt: ".gotmpl", Extends: "../b/config.hjson" }`,
+		"b/config.hjson": `{ TemplateTypeExt: ".gotmpl", Layers: [ "../a/config.hjson" ] }`,
+	})
+
+	_, err := sprout.OpenTemplate(filepath.Join(inputRoot, "a/config.hjson"), t.TempDir())
+	require.ErrorContains(t, err, "composes itself")
+}
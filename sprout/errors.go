@@ -0,0 +1,100 @@
+package sprout
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+
+	"github.com/treaster/sprout/processor"
+)
+
+// ErrorCategory says which part of a run an error came from, so that callers
+// can react to each kind of failure differently.
+type ErrorCategory string
+
+const (
+	// ConfigError is a problem with a template's config, or the options.
+	ConfigError ErrorCategory = "config"
+	// ParamsError is a problem with the params.
+	ParamsError ErrorCategory = "params"
+	// TemplateError is a template file which doesn't parse or execute.
+	TemplateError ErrorCategory = "template"
+	// WriteError is a problem reading or writing the output directory.
+	WriteError ErrorCategory = "write"
+	// PostProcessorError is a post-processor or hook which failed, or wasn't
+	// approved to run.
+	PostProcessorError ErrorCategory = "postprocessor"
+)
+
+// Error is an error from a run, with its category. File and Line locate the
+// error in a template, if it's known where it is. Line is 0 if only the file
+// is known.
+type Error struct {
+	Category ErrorCategory
+	File     string
+	Line     int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Category returns the category of err, or of the first error joined in err
+// which has one, or "" if none of them do.
+func Category(err error) ErrorCategory {
+	var sproutErr *Error
+	if errors.As(err, &sproutErr) {
+		return sproutErr.Category
+	}
+	return ""
+}
+
+// Errors returns the errors joined in err, with errors.Join, in order. An error
+// which isn't joined is returned alone.
+func Errors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, isJoined := err.(interface{ Unwrap() []error })
+	if !isJoined {
+		return []error{err}
+	}
+	var errs []error
+	for _, inner := range joined.Unwrap() {
+		errs = append(errs, Errors(inner)...)
+	}
+	return errs
+}
+
+// categorize gives each of errs the category, unless it already has one.
+func categorize(category ErrorCategory, errs ...error) []error {
+	categorized := make([]error, len(errs))
+	for i, err := range errs {
+		categorized[i] = err
+		if Category(err) == "" {
+			categorized[i] = &Error{Category: category, Err: err}
+		}
+	}
+	return categorized
+}
+
+// categorizeRendered categorizes an error from rendering the template t. A
+// processor.TemplateError is a TemplateError, located in t's files. Any other
+// error is a ConfigError, e.g. a DirsMapping directory which doesn't exist.
+func (t *Template) categorizeRendered(err error) error {
+	var templateErr *processor.TemplateError
+	if errors.As(err, &templateErr) {
+		return &Error{
+			Category: TemplateError,
+			File:     t.displayPath(path.Join(t.Root, filepath.ToSlash(templateErr.File))),
+			Line:     templateErr.Line,
+			Err:      err,
+		}
+	}
+	return categorize(ConfigError, err)[0]
+}
@@ -0,0 +1,443 @@
+package sprout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/treaster/sprout/processor"
+)
+
+const (
+	// DefaultDigestPath is where the digest is written, relative to the
+	// output directory, unless Options.DigestPath says otherwise.
+	DefaultDigestPath = "digest.json"
+
+	// Older versions of sprout wrote the digest as a list of paths, to this
+	// file. It's still read, if a digest isn't found at the default path.
+	legacyDigestPath = "digest.txt"
+)
+
+// Generator sprouts the template at Source into the Output directory, with
+// the given Params.
+type Generator struct {
+	// Source is the path of the template's config. See OpenTemplate.
+	Source  string
+	Params  processor.Params
+	Output  string
+	Options Options
+}
+
+// Options control how a Generator treats the output directory. The zero
+// value is the default behavior of the command line tool.
+type Options struct {
+	// DigestPath is the path of the digest, relative to Output. If empty,
+	// DefaultDigestPath is used.
+	DigestPath string
+	// ModifiedPolicy says what to do with files from the previous run which
+	// the user has modified since. If empty, they're skipped.
+	ModifiedPolicy processor.ModifiedPolicy
+	// Update merges the user's edits to files from the previous run with
+	// the new output, rather than applying ModifiedPolicy.
+	Update bool
+	// DryRun renders the template, and reports the changes a real run would
+	// make in Result.Diff, without changing anything on disk.
+	DryRun bool
+	// AutoRunPostProcessor runs the template's post-processor script and
+	// hooks, if any. Note that these can execute arbitrary commands. It's
+	// equivalent to a CommandPolicy of CommandsAuto.
+	AutoRunPostProcessor bool
+	// CommandPolicy says whether to run the template's post-processor script
+	// and hooks. If empty, it's CommandsAuto if AutoRunPostProcessor is set,
+	// and CommandsManual otherwise.
+	CommandPolicy CommandPolicy
+	// ApprovalsPath is where approvals are remembered, for CommandsAllowlist.
+	// If empty, DefaultApprovalsPath() is used.
+	ApprovalsPath string
+	// Approve asks the user to approve what a template will run, for
+	// CommandsAllowlist. If nil, a template which isn't approved already is
+	// an error.
+	Approve func(request ApprovalRequest) (bool, error)
+	// Jobs is how many templates are executed in parallel. If zero, it's
+	// runtime.GOMAXPROCS(0).
+	Jobs int
+	// CacheDir is where templates fetched from git repositories are cached.
+	// If empty, DefaultCacheDir() is used.
+	CacheDir string
+	// Log receives progress messages. If nil, they're discarded.
+	Log processor.Logf
+}
+
+// Result describes what a Generator did. Paths are relative to the output
+// directory.
+type Result struct {
+	Template *Template
+	// Written files were generated. Conflicted files were written with merge
+	// conflicts, which must be resolved by hand, and are also in Written.
+	Written    []string
+	Conflicted []string
+	// Skipped files were modified by the user, and left in place.
+	Skipped []string
+	// BackedUp files were modified by the user, and moved to BackupDir
+	// before being replaced.
+	BackedUp  []string
+	BackupDir string
+	// Deleted files were written by the previous run, and removed.
+	Deleted []string
+	// Remapped maps each output file which FilesMapping or a templated file
+	// name renamed to the path it would have had otherwise.
+	Remapped map[string]string
+	// Warnings are problems which didn't stop the run, like a modified file
+	// which couldn't be backed up, and so was skipped.
+	Warnings []string
+	// Diff is the unified diff of the changes, in a dry run.
+	Diff                []byte
+	Digest              processor.Digest
+	PostProcessorOutput []byte
+	// Hooks describes each hook step, in the order they were run.
+	Hooks []processor.HookResult
+}
+
+// DefaultCacheDir returns the sprout directory in the user's cache directory,
+// or a directory in the system temp directory if there isn't one.
+func DefaultCacheDir() string {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "sprout")
+	}
+	return filepath.Join(userCacheDir, "sprout")
+}
+
+// Run opens the template at g.Source, then sprouts it. See RunTemplate.
+func (g Generator) Run(ctx context.Context) (Result, error) {
+	cacheDir := g.Options.CacheDir
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir()
+	}
+	t, err := OpenTemplate(g.Source, cacheDir)
+	if err != nil {
+		return Result{}, err
+	}
+	return g.RunTemplate(ctx, t)
+}
+
+// RunTemplate sprouts an already opened template, ignoring g.Source. The
+// files written by the previous run, as recorded in its digest, are deleted
+// or handled according to the options, then the new output and digest are
+// written. All errors are returned, joined into one. Each is an *Error, whose
+// category says which part of the run failed, except for a cancellation
+// before anything was changed.
+//
+// The changes to the output directory are staged, then committed only if
+// every one was staged without error. If committing fails, or ctx is
+// cancelled, the changes are rolled back, leaving the output directory as it
+// was. The post-processor and PostGenerate hooks run after the commit, so
+// their changes can't be rolled back.
+func (g Generator) RunTemplate(ctx context.Context, t *Template) (Result, error) {
+	result := Result{Template: t}
+	logf := g.Options.Log
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+
+	warnf := func(s string, args ...any) {
+		logf(s, args...)
+		result.Warnings = append(result.Warnings, fmt.Sprintf(s, args...))
+	}
+
+	var errs []error
+	addError := func(s string, args ...any) {
+		errs = append(errs, &Error{Category: WriteError, Err: fmt.Errorf(s, args...)})
+	}
+	// fail returns the errors so far, and err, with the category.
+	fail := func(category ErrorCategory, err ...error) (Result, error) {
+		return result, errors.Join(append(errs, categorize(category, err...)...)...)
+	}
+
+	if g.Output == "" {
+		return fail(ConfigError, fmt.Errorf("output directory is required and not defined"))
+	}
+	outputRoot := filepath.Clean(g.Output) + "/"
+
+	modifiedPolicy := g.Options.ModifiedPolicy
+	if modifiedPolicy == "" {
+		modifiedPolicy = processor.ModifiedSkip
+	}
+	_, err := processor.ParseModifiedPolicy(string(modifiedPolicy))
+	if err != nil {
+		return fail(ConfigError, err)
+	}
+
+	commandPolicy := g.Options.CommandPolicy
+	if commandPolicy == "" && g.Options.AutoRunPostProcessor {
+		commandPolicy = CommandsAuto
+	}
+	if commandPolicy == "" {
+		commandPolicy = CommandsManual
+	}
+	_, err = ParseCommandPolicy(string(commandPolicy))
+	if err != nil {
+		return fail(ConfigError, err)
+	}
+
+	// Load the digest file, if it exists.
+	digestPath := g.Options.DigestPath
+	if digestPath == "" {
+		digestPath = DefaultDigestPath
+	}
+	absDigestPath := filepath.Join(outputRoot, digestPath)
+	if digestPath == DefaultDigestPath {
+		logf("using default digest path %s", absDigestPath)
+	}
+	readDigestPath := digestPath
+	digestBytes, err := os.ReadFile(absDigestPath)
+	if os.IsNotExist(err) && digestPath == DefaultDigestPath {
+		readDigestPath = legacyDigestPath
+		digestBytes, err = os.ReadFile(filepath.Join(outputRoot, legacyDigestPath))
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fail(WriteError, fmt.Errorf("error reading digest file: %s", err.Error()))
+	}
+
+	var previousDigest processor.Digest
+	var digestEntries []processor.DigestFile
+	if err == nil {
+		previousDigest, err = processor.ParseDigest(digestBytes)
+		if err != nil {
+			return fail(WriteError, fmt.Errorf("error parsing digest file: %s", err.Error()))
+		}
+		digestEntries = append(previousDigest.Files, processor.DigestFile{Path: readDigestPath})
+	}
+
+	// Check the params against the schema declared by the template config,
+	// if any. Report every violation at once, rather than failing on the
+	// first missing or malformed param during template execution.
+	paramsErrs := t.ParamsSchema().Validate(g.Params)
+	if len(paramsErrs) > 0 {
+		return fail(ParamsError, paramsErrs...)
+	}
+
+	// Render every template in the stack before touching the filesystem, so
+	// that a template error or a conflict between templates leaves the output
+	// directory as it was.
+	jobs := g.Options.Jobs
+	if jobs == 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	rendered, renderErrs := t.Render(outputRoot, g.Params, jobs, logf)
+	if len(renderErrs) > 0 {
+		return fail(TemplateError, renderErrs...)
+	}
+	for outputPath, outputFile := range rendered.Files {
+		if outputFile.RemappedFrom == "" {
+			continue
+		}
+		if result.Remapped == nil {
+			result.Remapped = map[string]string{}
+		}
+		result.Remapped[processor.SafeCutPrefix(outputPath, outputRoot)] = filepath.Join(outputFile.MappedDir, outputFile.RemappedFrom)
+	}
+
+	// Stop before doing any mutations to the filesystem, if cancelled.
+	err = ctx.Err()
+	if err != nil {
+		return result, err
+	}
+
+	// Find files which the user has modified since the previous run. Those
+	// which the policy skips, or which can't be checked, are left in place.
+	// The others are handled once the output is staged. In update mode, those
+	// files are merged instead.
+	skipFiles := map[string]processor.DigestFile{}
+	var modifiedFiles []processor.DigestFile
+	if !g.Options.Update {
+		for _, digestFile := range previousDigest.Files {
+			pathInOutput := filepath.Join(outputRoot, digestFile.Path)
+			isModified, err := digestFile.IsModified(outputRoot, os.ReadFile)
+			if err != nil {
+				warnf("error checking digest entry %s, skipped: %s", pathInOutput, err.Error())
+				skipFiles[digestFile.Path] = digestFile
+				continue
+			}
+			if !isModified {
+				continue
+			}
+			if modifiedPolicy == processor.ModifiedSkip {
+				logf("user-modified, skipped: %s", pathInOutput)
+				skipFiles[digestFile.Path] = digestFile
+				continue
+			}
+			modifiedFiles = append(modifiedFiles, digestFile)
+		}
+	}
+
+	// In dry-run mode, report what would change, then stop before touching
+	// the filesystem.
+	if g.Options.DryRun {
+		var diff bytes.Buffer
+		errs := processor.DryRun(
+			&diff,
+			outputRoot,
+			absDigestPath,
+			previousDigest.Paths(),
+			skipFiles,
+			g.Options.Update,
+			rendered.Files,
+			os.ReadFile,
+		)
+		result.Diff = diff.Bytes()
+		for _, postProcessorScript := range rendered.PostProcessorScripts {
+			logf("post-processor %s would not be run", postProcessorScript)
+		}
+		for _, step := range append(rendered.Hooks.PreGenerate, rendered.Hooks.PostGenerate...) {
+			logf("hook %s would not be run", step.Command)
+		}
+		return fail(WriteError, errs...)
+	}
+
+	// Check that the user has approved the post-processor and hooks, if
+	// they're to be run in a sandbox.
+	var sandbox *processor.Sandbox
+	runCommands := commandPolicy != CommandsManual
+	if commandPolicy == CommandsAllowlist {
+		sandbox, err = g.approve(t, rendered, outputRoot, logf)
+		if err != nil {
+			return fail(PostProcessorError, err)
+		}
+	}
+
+	// Run the PreGenerate hooks before touching any previous output. A failed
+	// step stops the run here.
+	err = os.MkdirAll(outputRoot, 0755)
+	if err != nil {
+		return fail(WriteError, fmt.Errorf("error creating output directory %s: %s", outputRoot, err.Error()))
+	}
+	preHookResults, hookErrs := processor.RunHooks(ctx, "PreGenerate", rendered.Hooks.PreGenerate, outputRoot, runCommands, sandbox, logf)
+	result.Hooks = preHookResults
+	if len(hookErrs) > 0 {
+		return fail(PostProcessorError, hookErrs...)
+	}
+
+	// Stage every change to the output directory, from removing the previous
+	// run's files to writing the digest, then commit them all at once, or
+	// roll them all back on an error or a cancellation.
+	tx, err := processor.BeginTransaction(processor.DiskFS{}, outputRoot, logf)
+	if err != nil {
+		return fail(WriteError, err)
+	}
+
+	// Back up or overwrite the other files the user has modified, according
+	// to the policy.
+	backupDir := processor.BackupDir(absDigestPath, time.Now())
+	for _, digestFile := range modifiedFiles {
+		pathInOutput := filepath.Join(outputRoot, digestFile.Path)
+		switch modifiedPolicy {
+		case processor.ModifiedBackup:
+			err := processor.BackupFile(tx, outputRoot, backupDir, digestFile.Path)
+			if err != nil {
+				warnf("error backing up %s, skipped: %s", pathInOutput, err.Error())
+				skipFiles[digestFile.Path] = digestFile
+				continue
+			}
+			logf("user-modified, backing up to %s: %s", backupDir, pathInOutput)
+			result.BackedUp = append(result.BackedUp, digestFile.Path)
+			result.BackupDir = backupDir
+		case processor.ModifiedOverwrite:
+			logf("user-modified, overwriting: %s", pathInOutput)
+		}
+	}
+
+	// Delete all entries from the digest, which represents files written by a
+	// previous run of sprout. Directories left empty are removed when the
+	// transaction is committed.
+	//
+	// In update mode, files the user has modified since the previous run are
+	// kept, so they can be merged with the new output.
+	baseRenderDir := processor.BaseRenderDir(absDigestPath)
+	for _, digestFile := range digestEntries {
+		digestEntry := digestFile.Path
+		if _, isSkipped := skipFiles[digestEntry]; isSkipped {
+			continue
+		}
+		if g.Options.Update && digestEntry != readDigestPath &&
+			!processor.MatchesBaseRender(outputRoot, baseRenderDir, digestEntry, os.ReadFile) {
+			logf("keeping modified digest entry %s", filepath.Join(outputRoot, digestEntry))
+			continue
+		}
+		pathInOutput := filepath.Join(outputRoot, digestEntry)
+		err = tx.Remove(pathInOutput)
+		// A file which is already gone, e.g. a post-processor which removed
+		// itself after running, or a backed up file, needs no deleting.
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			addError("error removing digest entry %s: %s", pathInOutput, err.Error())
+			continue
+		}
+		logf("delete digest entry %s", pathInOutput)
+		if digestEntry != readDigestPath {
+			result.Deleted = append(result.Deleted, digestEntry)
+		}
+	}
+
+	// Stage the rendered output.
+	processResult, processErrs := processor.StageOutput(
+		rendered.Files,
+		outputRoot,
+		t.Source,
+		absDigestPath,
+		g.Options.Update,
+		skipFiles,
+		g.Params,
+		tx,
+		logf,
+	)
+	result.Written = processResult.Written
+	result.Conflicted = processResult.Conflicted
+	result.Skipped = processResult.Skipped
+	result.Digest = processResult.Digest
+	errs = append(errs, categorize(WriteError, processErrs...)...)
+
+	// Commit the output only if every change was staged.
+	if len(errs) > 0 {
+		tx.Abort()
+		logf("nothing was changed in %s", outputRoot)
+		return fail(WriteError)
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fail(WriteError, err)
+	}
+	err = processor.MergeConflictsError(outputRoot, result.Conflicted)
+	if err != nil {
+		errs = append(errs, categorize(WriteError, err)...)
+	}
+
+	// Run the post-processor scripts on the committed output.
+	postProcessorOutput, postProcessorErrs := processor.RunPostProcessors(
+		outputRoot,
+		runCommands,
+		rendered.PostProcessorScripts,
+		sandbox,
+		g.Params,
+		processor.DiskFS{},
+		logf,
+	)
+	result.PostProcessorOutput = postProcessorOutput
+	errs = append(errs, categorize(PostProcessorError, postProcessorErrs...)...)
+
+	// Run the PostGenerate hooks, unless the output is incomplete.
+	if len(errs) == 0 {
+		postHookResults, hookErrs := processor.RunHooks(ctx, "PostGenerate", rendered.Hooks.PostGenerate, outputRoot, runCommands, sandbox, logf)
+		result.Hooks = append(result.Hooks, postHookResults...)
+		errs = append(errs, categorize(PostProcessorError, hookErrs...)...)
+	}
+
+	return result, errors.Join(errs...)
+}
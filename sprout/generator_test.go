@@ -0,0 +1,327 @@
+package sprout_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for path, contents := range files {
+		fullPath := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(contents), 0644))
+	}
+}
+
+func TestGeneratorRun(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			TemplateParamsFile: "params.hjson"
+			DirsMapping: { "templates": "{{ .name }}" }
+			ParamsSchema: { name: { Type: "string", Required: true } }
+		}`,
+		"params.hjson":              `{ name: "example" }`,
+		"templates/main.go.gotmpl":  "package {{ .name }}\n",
+		"templates/README.md":       "readme\n",
+		"templates/docs/old.gotmpl": "old\n",
+	})
+	outputRoot := t.TempDir()
+
+	var logLines []string
+	generator := sprout.Generator{
+		Source: filepath.Join(inputRoot, "config.hjson"),
+		Params: processor.Params{"name": "svc"},
+		Output: outputRoot,
+		Options: sprout.Options{
+			Log: func(format string, args ...any) {
+				logLines = append(logLines, format)
+			},
+		},
+	}
+
+	result, err := generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"svc/README.md", "svc/docs/old", "svc/main.go"}, result.Written)
+	require.Equal(t, []string{"svc/README.md", "svc/docs/old", "svc/main.go"}, result.Digest.Paths())
+	require.NotEmpty(t, logLines)
+
+	example, err := result.Template.ExampleParams()
+	require.NoError(t, err)
+	require.Equal(t, `{ name: "example" }`, string(example))
+
+	mainGo, err := os.ReadFile(filepath.Join(outputRoot, "svc/main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package svc\n", string(mainGo))
+
+	// Rerun after the user edits one file, and the template drops another.
+	writeFiles(t, outputRoot, map[string]string{"svc/README.md": "edited\n"})
+	require.NoError(t, os.Remove(filepath.Join(inputRoot, "templates/docs/old.gotmpl")))
+
+	generator.Options.DryRun = true
+	result, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, string(result.Diff), "--- a/svc/docs/old")
+	require.NotContains(t, string(result.Diff), "--- a/svc/README.md")
+	require.Contains(t, string(result.Diff), "keeping user-modified file "+filepath.Join(outputRoot, "svc/README.md"))
+	require.Empty(t, result.Written)
+
+	generator.Options.DryRun = false
+	result, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"svc/main.go"}, result.Written)
+	require.Equal(t, []string{"svc/README.md"}, result.Skipped)
+	require.Equal(t, []string{"svc/docs/old", "svc/main.go"}, result.Deleted)
+
+	readme, err := os.ReadFile(filepath.Join(outputRoot, "svc/README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "edited\n", string(readme))
+	_, err = os.Stat(filepath.Join(outputRoot, "svc/docs"))
+	require.True(t, os.IsNotExist(err))
+
+	// The edited file stays protected after the template stops rendering it.
+	require.NoError(t, os.Remove(filepath.Join(inputRoot, "templates/README.md")))
+	generator.Options.DryRun = true
+	result, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.NotContains(t, string(result.Diff), "--- a/svc/README.md")
+	generator.Options.DryRun = false
+	result, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"svc/README.md"}, result.Skipped)
+	require.Equal(t, []string{"svc/README.md", "svc/main.go"}, result.Digest.Paths())
+	result, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"svc/README.md"}, result.Skipped)
+	readme, err = os.ReadFile(filepath.Join(outputRoot, "svc/README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "edited\n", string(readme))
+
+	// Once the edit is reverted, it's cleaned up like any other file.
+	writeFiles(t, outputRoot, map[string]string{"svc/README.md": "readme\n"})
+	result, err = generator.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, result.Skipped)
+	require.Equal(t, []string{"svc/main.go"}, result.Digest.Paths())
+	_, err = os.Stat(filepath.Join(outputRoot, "svc/README.md"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestGeneratorRunErrors(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			DirsMapping: { "templates": "." }
+			ParamsSchema: { name: { Type: "string", Required: true } }
+		}`,
+		"templates/main.go.gotmpl": "package {{ .name }}\n",
+	})
+
+	generator := sprout.Generator{
+		Source: filepath.Join(inputRoot, "config.hjson"),
+		Params: processor.Params{},
+		Output: t.TempDir(),
+	}
+	_, err := generator.Run(context.Background())
+	require.ErrorContains(t, err, "param name: required but not defined")
+	require.Equal(t, sprout.ParamsError, sprout.Category(err))
+
+	generator.Source = filepath.Join(inputRoot, "missing.hjson")
+	_, err = generator.Run(context.Background())
+	require.ErrorContains(t, err, "error loading source config")
+
+	// A template error is located in the template.
+	writeFiles(t, inputRoot, map[string]string{"templates/broken.gotmpl": "ok\n{{ .name\n"})
+	generator.Source = filepath.Join(inputRoot, "config.hjson")
+	generator.Params = processor.Params{"name": "svc"}
+	_, err = generator.Run(context.Background())
+	require.Equal(t, sprout.TemplateError, sprout.Category(err))
+	var sproutErr *sprout.Error
+	require.ErrorAs(t, err, &sproutErr)
+	require.Equal(t, filepath.Join(inputRoot, "templates/broken.gotmpl"), sproutErr.File)
+	require.Equal(t, 3, sproutErr.Line)
+	require.NoError(t, os.Remove(filepath.Join(inputRoot, "templates/broken.gotmpl")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = generator.Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewReport(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			DirsMapping: { "templates": "app" }
+			FilesMapping: { "main.go": "{{ .name }}.go" }
+		}`,
+		"templates/main.go.gotmpl": "package {{ .name }}\n",
+		"templates/README.md":      "readme\n",
+	})
+
+	generator := sprout.Generator{
+		Source: filepath.Join(inputRoot, "config.hjson"),
+		Params: processor.Params{"name": "svc"},
+		Output: t.TempDir(),
+	}
+	result, err := generator.Run(context.Background())
+	require.NoError(t, err)
+	report := sprout.NewReport(result, err)
+	require.True(t, report.Success)
+	require.Equal(t, []string{"app/README.md", "app/svc.go"}, report.Written)
+	require.Equal(t, map[string]string{"app/svc.go": "app/main.go"}, report.Remapped)
+	require.Equal(t, []sprout.ReportError{}, report.Errors)
+
+	err = errors.Join(
+		&sprout.Error{Category: sprout.WriteError, Err: errors.New("disk full")},
+		errors.New("interrupted"),
+	)
+	report = sprout.NewReport(sprout.Result{}, err)
+	require.False(t, report.Success)
+	require.Equal(t, []sprout.ReportError{
+		{Category: sprout.WriteError, Message: "disk full"},
+		{Message: "interrupted"},
+	}, report.Errors)
+	require.Equal(t, []string{}, report.Written)
+}
+
+func TestGeneratorRunHooks(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			DirsMapping: { "templates": "." }
+			Hooks: {
+				PreGenerate: [
+					{ Name: "before", Command: "sh", Args: [ "-c", "ls > ../before.txt" ] },
+				]
+				PostGenerate: [
+					{ Name: "git", Command: "sh", Args: [ "-c", "echo git" ], If: "{{ .git }}" },
+					{ Name: "after", Command: "ls" },
+				]
+			}
+		}`,
+		"templates/main.go": "package main\n",
+	})
+	outputRoot := filepath.Join(t.TempDir(), "out")
+
+	result, err := sprout.Generator{
+		Source: filepath.Join(inputRoot, "config.hjson"),
+		Params: processor.Params{"git": false},
+		Output: outputRoot,
+		Options: sprout.Options{
+			AutoRunPostProcessor: true,
+		},
+	}.Run(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, result.Hooks, 3)
+	require.Equal(t, "PreGenerate", result.Hooks[0].Phase)
+	require.True(t, result.Hooks[1].Skipped)
+	require.Equal(t, "after", result.Hooks[2].Name)
+	require.Equal(t, "digest.base\ndigest.json\nmain.go\n", string(result.Hooks[2].Output))
+
+	before, err := os.ReadFile(filepath.Join(outputRoot, "../before.txt"))
+	require.NoError(t, err)
+	require.Empty(t, string(before))
+}
+
+func TestGeneratorPostProcessor(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			DirsMapping: { "templates": "." }
+			PostProcessorScript: "post.sh"
+		}`,
+		"templates/main.go": "package main\n",
+		"templates/post.sh": "#!/bin/sh\npwd\necho $SPROUT_OUTPUT_ROOT $SPROUT_PARAM_NAME $SPROUT_PARAM_DB_MAX_CONNS $SPROUT_PARAM_TAGS\nprintf partial\n",
+	})
+
+	// Use a relative output directory, which used to break once the
+	// post-processor had changed the working directory.
+	workDir := t.TempDir()
+	t.Chdir(workDir)
+
+	var logLines []string
+	result, err := sprout.Generator{
+		Source: filepath.Join(inputRoot, "config.hjson"),
+		Params: processor.Params{"name": "svc", "db": map[string]any{"max-conns": 10}, "tags": []any{"a", "b"}},
+		Output: "out/",
+		Options: sprout.Options{
+			AutoRunPostProcessor: true,
+			Log: func(format string, args ...any) {
+				logLines = append(logLines, fmt.Sprintf(format, args...))
+			},
+		},
+	}.Run(context.Background())
+	require.NoError(t, err)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	require.Equal(t, workDir, cwd)
+
+	absOutputRoot := filepath.Join(workDir, "out")
+	expected := absOutputRoot + "\n" + absOutputRoot + ` svc 10 ["a","b"]` + "\npartial"
+	require.Equal(t, expected, string(result.PostProcessorOutput))
+	require.Contains(t, logLines, "post-processor: "+absOutputRoot)
+	require.Contains(t, logLines, "post-processor: partial")
+
+	_, err = os.Stat(filepath.Join(absOutputRoot, "post.sh"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestGeneratorRollback(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			DirsMapping: { "templates": "." }
+		}`,
+		"templates/main.go.gotmpl": "package {{ .name }}\n",
+		"templates/old.txt":        "old\n",
+	})
+	outputRoot := t.TempDir()
+
+	generator := sprout.Generator{
+		Source: filepath.Join(inputRoot, "config.hjson"),
+		Params: processor.Params{"name": "svc"},
+		Output: outputRoot,
+	}
+	_, err := generator.Run(context.Background())
+	require.NoError(t, err)
+	digestBefore, err := os.ReadFile(filepath.Join(outputRoot, "digest.json"))
+	require.NoError(t, err)
+
+	// The template now drops old.txt, and adds docs/new.txt, but the user
+	// has a file named docs, so the new output can't be committed.
+	require.NoError(t, os.Remove(filepath.Join(inputRoot, "templates/old.txt")))
+	writeFiles(t, inputRoot, map[string]string{"templates/docs/new.txt": "new\n"})
+	writeFiles(t, outputRoot, map[string]string{"docs": "the user's file\n"})
+
+	generator.Params["name"] = "changed"
+	_, err = generator.Run(context.Background())
+	require.ErrorContains(t, err, "rolled back all changes")
+
+	for path, expected := range map[string]string{
+		"main.go":     "package svc\n",
+		"old.txt":     "old\n",
+		"docs":        "the user's file\n",
+		"digest.json": string(digestBefore),
+	} {
+		content, err := os.ReadFile(filepath.Join(outputRoot, path))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(content), path)
+	}
+}
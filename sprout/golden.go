@@ -0,0 +1,101 @@
+package sprout
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+
+	"github.com/treaster/sprout/processor"
+)
+
+// TestDataDir is the directory, next to a template's config, which holds its
+// golden test cases. See processor.GoldenCase.
+const TestDataDir = "testdata"
+
+// Renderer returns a function which checks params against the template's
+// ParamsSchema, then renders the template with up to jobs workers, keyed by
+// paths relative to the output directory. It's for golden tests, e.g. with
+// processor.CheckGolden.
+func (t *Template) Renderer(jobs int) processor.RenderFunc {
+	return func(params processor.Params) (map[string]processor.OutputFile, []error) {
+		errs := t.ParamsSchema().Validate(params)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		rendered, errs := t.Render("", params, jobs, func(string, ...any) {})
+		return rendered.Files, errs
+	}
+}
+
+// TestResult describes what Template.Test did. Cases are named by their
+// directories in the testdata directory.
+type TestResult struct {
+	Passed  []string
+	Failed  []string
+	Updated []string
+	// Diff holds the errors of each failed case, or the differences between
+	// its rendered and expected output.
+	Diff []byte
+}
+
+// Test renders each of the template's golden test cases in memory, and
+// compares the output with the case's expected tree. If update is true, the
+// expected tree of each case whose output differs is rewritten instead, which
+// is only possible for a template on the local filesystem. Up to jobs files
+// are rendered in parallel.
+func (t *Template) Test(update bool, jobs int, logf processor.Logf) (TestResult, error) {
+	var result TestResult
+	if update && (t.localDir == "" || t.Source.Commit != "") {
+		return result, fmt.Errorf("can't update the expected output of %s, which isn't on the local filesystem", t.Source.Config)
+	}
+
+	testdataDir := path.Join(t.Root, TestDataDir)
+	cases, err := processor.FindGoldenCases(t.FS, testdataDir)
+	if err != nil {
+		return result, err
+	}
+	if len(cases) == 0 {
+		return result, fmt.Errorf("no test cases found in %s", t.displayPath(testdataDir))
+	}
+
+	render := t.Renderer(jobs)
+	var diff bytes.Buffer
+	for _, c := range cases {
+		outputContents, errs := render(c.Params)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Fprintf(&diff, "error rendering test case %s: %s\n", c.Name, err.Error())
+			}
+			logf("FAIL %s", c.Name)
+			result.Failed = append(result.Failed, c.Name)
+			continue
+		}
+
+		expectedDir := path.Join(c.Dir, processor.GoldenExpectedDir)
+		var caseDiff bytes.Buffer
+		differences, err := processor.CompareGolden(&caseDiff, outputContents, t.FS, expectedDir)
+		if err != nil {
+			return result, err
+		}
+
+		switch {
+		case differences == 0:
+			logf("ok   %s", c.Name)
+			result.Passed = append(result.Passed, c.Name)
+		case update:
+			err := processor.WriteGolden(outputContents, t.displayPath(expectedDir), processor.DiskFS{})
+			if err != nil {
+				return result, err
+			}
+			logf("updated %d files of %s", differences, c.Name)
+			result.Updated = append(result.Updated, c.Name)
+		default:
+			fmt.Fprintf(&diff, "%d files of test case %s differ from %s:\n", differences, c.Name, t.displayPath(expectedDir))
+			diff.Write(caseDiff.Bytes())
+			logf("FAIL %s", c.Name)
+			result.Failed = append(result.Failed, c.Name)
+		}
+	}
+	result.Diff = diff.Bytes()
+	return result, nil
+}
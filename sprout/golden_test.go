@@ -0,0 +1,65 @@
+package sprout_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
+)
+
+func TestTemplateTest(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			DirsMapping: { "templates": "." }
+			ParamsSchema: { name: { Type: "string", Required: true } }
+		}`,
+		"templates/README.md.gotmpl":          "# {{ .name }}\n",
+		"testdata/a/params.hjson":             "name: a\n",
+		"testdata/a/expected/README.md":       "# a\n",
+		"testdata/b/params.hjson":             "name: b\n",
+		"testdata/b/expected/README.md":       "# old b\n",
+		"testdata/b/expected/CHANGELOG.md":    "gone\n",
+		"testdata/invalid/params.hjson":       "other: x\n",
+		"testdata/invalid/expected/README.md": "# x\n",
+	})
+	template, err := sprout.OpenTemplate(filepath.Join(inputRoot, "config.hjson"), t.TempDir())
+	require.NoError(t, err)
+
+	result, err := template.Test(false, 1, processor.Printfln)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, result.Passed)
+	require.Equal(t, []string{"b", "invalid"}, result.Failed)
+	require.Contains(t, string(result.Diff), "-# old b\n+# b\n")
+	require.Contains(t, string(result.Diff), "--- expected/CHANGELOG.md\n+++ /dev/null\n")
+	require.Contains(t, string(result.Diff), "error rendering test case invalid: ")
+
+	// Updating rewrites the expected output of b, but a case which doesn't
+	// render still fails.
+	result, err = template.Test(true, 1, processor.Printfln)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, result.Passed)
+	require.Equal(t, []string{"b"}, result.Updated)
+	require.Equal(t, []string{"invalid"}, result.Failed)
+	readme, err := os.ReadFile(filepath.Join(inputRoot, "testdata/b/expected/README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "# b\n", string(readme))
+	_, err = os.Stat(filepath.Join(inputRoot, "testdata/b/expected/CHANGELOG.md"))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, os.RemoveAll(filepath.Join(inputRoot, "testdata/invalid")))
+	result, err = template.Test(false, 1, processor.Printfln)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, result.Passed)
+	require.Empty(t, result.Diff)
+}
+
+func TestExampleGolden(t *testing.T) {
+	template, err := sprout.OpenTemplate("../example/config.hjson", t.TempDir())
+	require.NoError(t, err)
+	processor.CheckGolden(t, template.Renderer(1), "../example/testdata", false)
+}
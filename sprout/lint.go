@@ -0,0 +1,126 @@
+package sprout
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/treaster/sprout/processor"
+)
+
+// Lint checks the template, and every template it composes, without rendering
+// any output. The example params from the TemplateParamsFiles stand in for the
+// params, to resolve each config.
+//
+// It returns a finding for every template or config which doesn't parse or
+// resolve, every DirsMapping key which isn't a directory, every FilesMapping
+// key which isn't a file, every param which a template refers to but no
+// TemplateParamsFile sets, and every param which a TemplateParamsFile sets
+// but no template refers to. The findings are sorted by file and line. Each
+// file is named by its path on the local filesystem, or in its archive.
+func (t *Template) Lint() []processor.LintFinding {
+	var findings []processor.LintFinding
+	addFinding := func(file string, line int, s string, args ...any) {
+		findings = append(findings, processor.LintFinding{File: file, Line: line, Message: fmt.Sprintf(s, args...)})
+	}
+
+	// Load the example params of the whole stack, remembering which params
+	// file sets each param, with the highest precedence.
+	stack := t.Stack()
+	params := processor.Params{}
+	setBy := map[string]*Template{}
+	var paramsFiles []string
+	for _, member := range stack {
+		if member.Config.TemplateParamsFile == "" {
+			continue
+		}
+		paramsFile := member.displayPath(path.Join(member.Root, member.Config.TemplateParamsFile))
+		paramsFiles = append(paramsFiles, paramsFile)
+
+		var memberParams processor.Params
+		err := member.Loader().LoadFile(member.Config.TemplateParamsFile, &memberParams)
+		if err != nil {
+			addFinding(paramsFile, 0, "error loading params: %s", err.Error())
+			continue
+		}
+		for name, value := range memberParams {
+			params[name] = value
+			setBy[name] = member
+		}
+	}
+
+	refs := map[string][]processor.ParamRef{}
+	for _, member := range stack {
+		configFile := member.displayPath(path.Join(member.Root, member.ConfigFile))
+		templateMgrFactory, err := member.TemplateEngine()
+		if err != nil {
+			addFinding(configFile, 0, "%s", err.Error())
+			continue
+		}
+
+		// Lint the config as written, so that the FilesMapping values are
+		// linted as templated file names.
+		memberFindings, memberRefs := processor.LintTemplates(templateMgrFactory, member.Root, member.ConfigFile, member.Config, member.FS)
+		configIsValid := true
+		for _, finding := range memberFindings {
+			finding.File = member.displayPath(finding.File)
+			configIsValid = configIsValid && finding.File != configFile
+			findings = append(findings, finding)
+		}
+		for file, fileRefs := range memberRefs {
+			file = member.displayPath(file)
+			refs[file] = append(refs[file], fileRefs...)
+		}
+
+		// A config which parses may still fail to execute, or to deserialize,
+		// once it's resolved. Any other problem with the config is reported
+		// first, since it's likely the cause.
+		_, err = member.ResolveConfig(params)
+		if err != nil && configIsValid {
+			addFinding(configFile, 0, "%s", err.Error())
+		}
+	}
+
+	if len(paramsFiles) == 0 {
+		addFinding(t.displayPath(path.Join(t.Root, t.ConfigFile)), 0, "no TemplateParamsFile is set, so the params which the templates refer to can't be checked")
+	} else {
+		used := map[string]bool{}
+		for _, file := range slices.Sorted(maps.Keys(refs)) {
+			for _, ref := range refs[file] {
+				used[ref.Name] = true
+				_, hasParam := params[ref.Name]
+				if !hasParam && !ref.Uncertain {
+					addFinding(file, ref.Line, "param %q isn't set in %s", ref.Name, strings.Join(paramsFiles, " or "))
+				}
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(setBy)) {
+			if used[name] {
+				continue
+			}
+			member := setBy[name]
+			paramsBytes, _ := member.Loader().LoadFileAsBytes(member.Config.TemplateParamsFile)
+			addFinding(member.displayPath(path.Join(member.Root, member.Config.TemplateParamsFile)),
+				processor.FindKeyLine(paramsBytes, name), "param %q isn't used by any template", name)
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a processor.LintFinding, b processor.LintFinding) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+	return findings
+}
+
+// displayPath returns the path of name, a file in t.FS, as the user knows it:
+// its path on the local filesystem, or in its archive.
+func (t *Template) displayPath(name string) string {
+	if t.localDir != "" {
+		return filepath.Join(t.localDir, filepath.FromSlash(name))
+	}
+	return t.archivePath + "//" + name
+}
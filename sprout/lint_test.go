@@ -0,0 +1,65 @@
+package sprout_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/treaster/sprout/processor"
+	"github.com/treaster/sprout/sprout"
+)
+
+func TestLint(t *testing.T) {
+	inputRoot := t.TempDir()
+	writeFiles(t, inputRoot, map[string]string{
+		"base/config.hjson": `{
+			TemplateTypeExt: ".gotmpl"
+			TemplateParamsFile: "params.hjson"
+			DirsMapping: { "templates": "." }
+		}`,
+		"base/params.hjson":            "{\n  name: base\n  unused: x\n  docker: true\n}\n",
+		"base/templates/go.mod.gotmpl": "module {{ .name }}\n",
+
+		"docker/config.hjson": `{
+			TemplateTypeExt: ".jet"
+			Extends: "../base/config.hjson"
+			DirsMapping: {
+				"templates": "."
+				"missing": "."
+			}
+			Conditions: { "Dockerfile": "{{ .docker }}" }
+		}`,
+		"docker/templates/Dockerfile.jet": "FROM {{ .name }}\n\nRUN {{ .typo }}\n",
+		"docker/templates/broken.jet":     "{{ if .name }}\n",
+	})
+
+	template, err := sprout.OpenTemplate(filepath.Join(inputRoot, "docker/config.hjson"), t.TempDir())
+	require.NoError(t, err)
+
+	var findings []string
+	for _, finding := range template.Lint() {
+		rel, err := filepath.Rel(inputRoot, finding.File)
+		require.NoError(t, err)
+		finding.File = rel
+		findings = append(findings, finding.String())
+	}
+	require.Equal(t, []string{
+		`base/params.hjson:3: param "unused" isn't used by any template`,
+		`docker/config.hjson:6: DirsMapping key "missing" isn't a directory in .`,
+		`docker/templates/Dockerfile.jet:3: param "typo" isn't set in ` + filepath.Join(inputRoot, "base/params.hjson"),
+		"docker/templates/broken.jet:2: template: /broken.jet:2: unexpected EOF",
+	}, findings)
+
+	// A template with no params file can't have its params checked.
+	writeFiles(t, inputRoot, map[string]string{
+		"plain/config.hjson":       `{ TemplateTypeExt: ".gotmpl", DirsMapping: { "templates": "." } }`,
+		"plain/templates/a.txt":    "a\n",
+		"plain/templates/b.gotmpl": "{{ .b }}\n",
+	})
+	template, err = sprout.OpenTemplate(filepath.Join(inputRoot, "plain/config.hjson"), t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, []processor.LintFinding{{
+		File:    filepath.Join(inputRoot, "plain/config.hjson"),
+		Message: "no TemplateParamsFile is set, so the params which the templates refer to can't be checked",
+	}}, template.Lint())
+}
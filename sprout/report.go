@@ -0,0 +1,105 @@
+package sprout
+
+import (
+	"errors"
+)
+
+// Report is a machine-readable summary of a run, for CI pipelines and other
+// programs which drive the command line tool. It's what the tool prints for
+// --output-format=json. Paths are relative to the output directory.
+type Report struct {
+	Success        bool
+	Template       string
+	TemplateCommit string `json:",omitempty"`
+	Written        []string
+	Conflicted     []string
+	Skipped        []string
+	BackedUp       []string
+	BackupDir      string `json:",omitempty"`
+	Deleted        []string
+	// Remapped maps each output file which was renamed to the path it would
+	// have had otherwise.
+	Remapped map[string]string
+	Warnings []string
+	Errors   []ReportError
+	// Diff is the unified diff of the changes, in a dry run.
+	Diff                string `json:",omitempty"`
+	PostProcessorOutput string
+	Hooks               []ReportHook
+}
+
+// ReportError is an error in a Report. Category is empty for an error outside
+// the categories, like a cancellation. File and Line are set where the error
+// is known to be in a template.
+type ReportError struct {
+	Category ErrorCategory
+	File     string `json:",omitempty"`
+	Line     int    `json:",omitempty"`
+	Message  string
+}
+
+// ReportHook is a hook step in a Report. See processor.HookResult.
+type ReportHook struct {
+	Phase    string
+	Name     string
+	Skipped  bool
+	Output   string
+	Duration string
+	Error    string `json:",omitempty"`
+}
+
+// NewReport returns the report of a run, from what RunTemplate returned.
+func NewReport(result Result, err error) Report {
+	nonNil := func(paths []string) []string {
+		if paths == nil {
+			return []string{}
+		}
+		return paths
+	}
+
+	report := Report{
+		Success:             err == nil,
+		Written:             nonNil(result.Written),
+		Conflicted:          nonNil(result.Conflicted),
+		Skipped:             nonNil(result.Skipped),
+		BackedUp:            nonNil(result.BackedUp),
+		BackupDir:           result.BackupDir,
+		Deleted:             nonNil(result.Deleted),
+		Remapped:            result.Remapped,
+		Warnings:            nonNil(result.Warnings),
+		Errors:              []ReportError{},
+		Diff:                string(result.Diff),
+		PostProcessorOutput: string(result.PostProcessorOutput),
+		Hooks:               []ReportHook{},
+	}
+	if report.Remapped == nil {
+		report.Remapped = map[string]string{}
+	}
+	if result.Template != nil {
+		report.Template = result.Template.Source.Config
+		report.TemplateCommit = result.Template.Source.Commit
+	}
+
+	for _, err := range Errors(err) {
+		reportErr := ReportError{Message: err.Error()}
+		var sproutErr *Error
+		if errors.As(err, &sproutErr) {
+			reportErr.Category = sproutErr.Category
+			reportErr.File = sproutErr.File
+			reportErr.Line = sproutErr.Line
+		}
+		report.Errors = append(report.Errors, reportErr)
+	}
+
+	for _, hook := range result.Hooks {
+		report.Hooks = append(report.Hooks, ReportHook{
+			Phase:    hook.Phase,
+			Name:     hook.Name,
+			Skipped:  hook.Skipped,
+			Output:   string(hook.Output),
+			Duration: hook.Duration.String(),
+			Error:    hook.Error,
+		})
+	}
+	return report
+}
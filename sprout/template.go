@@ -0,0 +1,227 @@
+// Package sprout sprouts templates into output directories. It's the library
+// behind the sprout command line tool, for driving sprout from other
+// programs. Nothing in this package prints or exits; progress is reported
+// through Options.Log, and failures are returned as errors.
+package sprout
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/treaster/sprout/processor"
+)
+
+// TemplateEngines maps each supported TemplateTypeExt to a constructor for
+// its template engine.
+var TemplateEngines = map[string]func() processor.TemplateMgr{
+	".gotmpl":   processor.GoTemplateMgr,
+	".jet":      processor.JetTemplateMgr,
+	".pongo":    processor.PongoTemplateMgr,
+	".mustache": processor.MustacheTemplateMgr,
+}
+
+// Template is a template, opened from its source and ready to sprout.
+type Template struct {
+	// FS holds the template's files, beneath Root.
+	FS   fs.FS
+	Root string
+	// ConfigFile is the name of the config file, in Root.
+	ConfigFile string
+	Source     processor.TemplateSource
+	// Config is the template's config, as written. Its template expressions
+	// are resolved against the params by ResolveConfig.
+	Config processor.Config
+	// Extends and Layers are the templates named by Config.Extends and
+	// Config.Layers. See Stack.
+	Extends *Template
+	Layers  []*Template
+
+	// The directory of the config file on the local filesystem, for a
+	// template which is on disk, or fetched from a git repository.
+	localDir string
+	// The path of the archive, for a template inside an archive.
+	archivePath string
+}
+
+// OpenTemplate opens the template whose config is at source, and loads its
+// config, along with any templates it extends or layers. The source is the
+// path of a config file on the local filesystem, a config inside a git
+// repository (see processor.GitSource), or a config inside a .tar.gz, .tgz or
+// .zip archive (see processor.IsArchiveSource). Git repositories are cached
+// beneath cacheDir.
+func OpenTemplate(source string, cacheDir string) (*Template, error) {
+	if source == "" {
+		return nil, fmt.Errorf("template source is required and not defined")
+	}
+	return openTemplate(source, cacheDir, map[string]*Template{}, nil)
+}
+
+// openTemplate opens the template at source. opened holds every template
+// opened so far, by source, so that a template composed twice (e.g. a base
+// extended by two layers) is only opened once. chain holds the sources of the
+// templates which compose this one, to detect cycles.
+func openTemplate(source string, cacheDir string, opened map[string]*Template, chain []string) (*Template, error) {
+	// A template in a git repository is fetched into the cache, then read
+	// from there like any other template on the local filesystem. A template
+	// in an archive is read into memory.
+	t := &Template{
+		FS:         os.DirFS(filepath.Dir(source)),
+		Root:       ".",
+		ConfigFile: filepath.Base(source),
+		Source:     processor.TemplateSource{Config: source},
+		localDir:   filepath.Dir(source),
+	}
+	if processor.IsGitSource(source) {
+		gitSource, err := processor.ParseGitSource(source)
+		var localConfigPath string
+		if err == nil {
+			localConfigPath, t.Source.Commit, err = gitSource.Fetch(cacheDir)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching template: %s", err.Error())
+		}
+		t.FS = os.DirFS(filepath.Dir(localConfigPath))
+		t.localDir = filepath.Dir(localConfigPath)
+	} else if processor.IsArchiveSource(source) {
+		archivePath, configPath, err := processor.ParseArchiveSource(source)
+		var archive *processor.MemFS
+		if err == nil {
+			archive, err = processor.OpenArchive(archivePath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error opening template: %s", err.Error())
+		}
+		t.FS = archive
+		t.Root = path.Dir(configPath)
+		t.ConfigFile = path.Base(configPath)
+		t.localDir = ""
+		t.archivePath = archivePath
+	}
+
+	return t.load(cacheDir, opened, chain)
+}
+
+// load loads the template's config, then opens the templates it extends and
+// layers.
+func (t *Template) load(cacheDir string, opened map[string]*Template, chain []string) (*Template, error) {
+	source := t.Source.Config
+	if slices.Contains(chain, source) {
+		return nil, fmt.Errorf("template %s composes itself, via %s", source, strings.Join(chain, " -> "))
+	}
+	if existing, isOpened := opened[source]; isOpened {
+		return existing, nil
+	}
+
+	err := t.Loader().LoadFile(t.ConfigFile, &t.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error loading source config: %s", err.Error())
+	}
+
+	chain = append(chain, source)
+	if t.Config.Extends != "" {
+		t.Extends, err = t.openComposed(t.Config.Extends, cacheDir, opened, chain)
+		if err != nil {
+			return nil, fmt.Errorf("error opening Extends of %s: %w", source, err)
+		}
+	}
+	for _, layer := range t.Config.Layers {
+		layerTemplate, err := t.openComposed(layer, cacheDir, opened, chain)
+		if err != nil {
+			return nil, fmt.Errorf("error opening Layers of %s: %w", source, err)
+		}
+		t.Layers = append(t.Layers, layerTemplate)
+	}
+
+	opened[source] = t
+	return t, nil
+}
+
+// openComposed opens a template named by the Extends or Layers of t. A git
+// source, archive source or absolute path is opened as is. Any other path is
+// relative to the directory of t's config, within the same archive, if t is
+// in one.
+func (t *Template) openComposed(ref string, cacheDir string, opened map[string]*Template, chain []string) (*Template, error) {
+	if processor.IsGitSource(ref) || processor.IsArchiveSource(ref) || filepath.IsAbs(ref) {
+		return openTemplate(ref, cacheDir, opened, chain)
+	}
+	if t.localDir != "" {
+		return openTemplate(filepath.Join(t.localDir, ref), cacheDir, opened, chain)
+	}
+
+	configPath := path.Join(t.Root, ref)
+	if !fs.ValidPath(configPath) {
+		return nil, fmt.Errorf("template %q is outside the archive %s", ref, t.archivePath)
+	}
+	composed := &Template{
+		FS:          t.FS,
+		Root:        path.Dir(configPath),
+		ConfigFile:  path.Base(configPath),
+		Source:      processor.TemplateSource{Config: t.archivePath + "//" + configPath},
+		archivePath: t.archivePath,
+	}
+	return composed.load(cacheDir, opened, chain)
+}
+
+// Loader returns a loader for the files of the template.
+func (t *Template) Loader() processor.FileLoader {
+	return processor.MakeFileLoader(t.FS, t.Root, ".")
+}
+
+// TemplateEngine returns the constructor of the template engine selected by
+// the config's TemplateTypeExt.
+func (t *Template) TemplateEngine() (func() processor.TemplateMgr, error) {
+	templateMgrFactory, hasExt := TemplateEngines[t.Config.TemplateTypeExt]
+	if !hasExt {
+		return nil, fmt.Errorf("unrecognized template type %q in config", t.Config.TemplateTypeExt)
+	}
+	return templateMgrFactory, nil
+}
+
+// NewTemplateMgr returns a new instance of the template engine selected by the
+// config's TemplateTypeExt.
+func (t *Template) NewTemplateMgr() (processor.TemplateMgr, error) {
+	templateMgrFactory, err := t.TemplateEngine()
+	if err != nil {
+		return nil, err
+	}
+	return templateMgrFactory(), nil
+}
+
+// ResolveConfig parses the config file as a template, and executes it with
+// the params. This fully resolves any templated values anywhere in the
+// config.
+func (t *Template) ResolveConfig(params processor.Params) (processor.Config, error) {
+	var processedConfig processor.Config
+	templateMgr, err := t.NewTemplateMgr()
+	if err != nil {
+		return processedConfig, err
+	}
+
+	loader := t.Loader()
+	configBytes, err := loader.LoadFileAsBytes(t.ConfigFile)
+	if err != nil {
+		return processedConfig, fmt.Errorf("error reloading config for template rewrite: %s", err.Error())
+	}
+	err = templateMgr.ParseOne("__config__", configBytes)
+	if err != nil {
+		return processedConfig, fmt.Errorf("error processing config as template: %s", err.Error())
+	}
+
+	var processedConfigBuf bytes.Buffer
+	err = templateMgr.Execute("__config__", params, &processedConfigBuf)
+	if err != nil {
+		return processedConfig, fmt.Errorf("error executing config template: %s", err.Error())
+	}
+
+	err = loader.DeserializeBytes(t.ConfigFile, processedConfigBuf.Bytes(), &processedConfig)
+	if err != nil {
+		return processedConfig, fmt.Errorf("error deserializing processed config bytes: %s", err.Error())
+	}
+	return processedConfig, nil
+}